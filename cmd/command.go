@@ -1,11 +1,16 @@
 package cmd
 
 import (
+	"fmt"
+
 	"github.com/gookit/config/v2"
 	"github.com/gookit/config/v2/toml"
 	"github.com/gookit/config/v2/yaml"
 	"github.com/gookit/slog"
+	"github.com/inherelab/genid/fileid"
 	"github.com/inherelab/genid/mysqlid"
+	"github.com/inherelab/genid/pgsqlid"
+	"github.com/inherelab/genid/sqliteid"
 )
 
 const (
@@ -19,23 +24,63 @@ func init() {
 	config.AddDriver(yaml.Driver)
 }
 
-func prepare(confFile string) error {
+func prepare(confFile string) (mysqlid.Storage, error) {
 	// loac config
 	slog.Info("load config from:", confFile)
 	err := config.LoadFiles(confFile)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// init mysqlId generator
-	dbCfg := &mysqlid.DBConfig{}
-	err = config.MapStruct("db", dbCfg)
+	cfg := mysqlid.NewConfig()
+	err = config.Decode(cfg)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	// dump.Println(dbCfg)
+	// dump.Println(cfg)
+
+	mysqlid.SetConfig(cfg)
+	return newStorage(cfg)
+}
 
-	_, err = mysqlid.InitSqlDB(dbCfg)
+// create the id storage by config
+func newStorage(cfg *mysqlid.Config) (mysqlid.Storage, error) {
+	slog.Info("init the id storage, driver:", cfg.Storage)
+
+	switch cfg.Storage {
+	case mysqlid.StorageMySQL:
+		db, err := mysqlid.InitSqlDB(cfg.DbConfig)
+		if err != nil {
+			return nil, err
+		}
+		return mysqlid.NewMySQLStorage(db), nil
+	case mysqlid.StorageSQLite:
+		sqliteCfg := &sqliteid.Config{}
+		if err := config.MapStruct("sqlite", sqliteCfg); err != nil {
+			return nil, err
+		}
+		return sqliteid.NewStorageByConfig(sqliteCfg)
+	case mysqlid.StoragePostgres:
+		pgCfg := &pgsqlid.Config{}
+		if err := config.MapOnExists("postgres", pgCfg); err != nil {
+			return nil, err
+		}
+
+		db, err := pgsqlid.OpenDB(cfg.DbConfig, pgCfg.SSLMode)
+		if err != nil {
+			return nil, err
+		}
+		return pgsqlid.NewStorage(db, pgCfg.Mode, cfg.TableName, cfg.TablePrefix)
+	case mysqlid.StorageFile:
+		fileCfg := &fileid.Config{}
+		if err := config.MapStruct("file", fileCfg); err != nil {
+			return nil, err
+		}
+		return fileid.NewStorage(fileCfg)
+	case mysqlid.StorageMemory:
+		return mysqlid.NewMemoryStorage(), nil
+	}
 
-	return err
+	return nil, fmt.Errorf("not supported storage driver: %s", cfg.Storage)
 }
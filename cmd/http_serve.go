@@ -27,7 +27,7 @@ var HttpServeCommand = &gcli.Command{
 		c.StrOpt(&httpSrvOpts.logLevel, "log-level", "l", "error", "log level. allow: debug|info|warn|error")
 	},
 	Func: func(c *gcli.Command, args []string) error {
-		err := prepare(httpSrvOpts.config)
+		store, err := prepare(httpSrvOpts.config)
 		if err != nil {
 			return err
 		}
@@ -36,7 +36,7 @@ var HttpServeCommand = &gcli.Command{
 
 		// init mysqlId generator manager
 		slog.Info("init the default mysqlId generator manager")
-		err = mysqlid.InitStdManager(mysqlid.Db)
+		err = mysqlid.InitStdManager(store)
 		if err != nil {
 			slog.Fatal(err)
 		}
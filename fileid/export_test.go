@@ -0,0 +1,18 @@
+package fileid
+
+import "os"
+
+// ReadOnlyLog reopen the log file read only, for the tests of the failed write.
+func ReadOnlyLog(s *Storage) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	f, err := os.Open(s.logFile())
+	if err != nil {
+		return err
+	}
+
+	s.file.Close()
+	s.file = f
+	return nil
+}
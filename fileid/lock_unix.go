@@ -0,0 +1,27 @@
+//go:build !windows
+// +build !windows
+
+package fileid
+
+import (
+	"os"
+	"syscall"
+)
+
+// lock the file exclusively, returns errLocked if it's locked by another process.
+// the lock is released on the file closed or the process exited.
+func lockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, errLocked
+		}
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,28 @@
+package fileid
+
+import (
+	"os"
+	"syscall"
+)
+
+// the windows error of the file is opened by another process
+const errorSharingViolation syscall.Errno = 32
+
+// lock the file exclusively by open it without sharing, returns errLocked if it's opened by another process.
+// the lock is released on the file closed or the process exited.
+func lockFile(path string) (*os.File, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := syscall.CreateFile(name, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil,
+		syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		if err == errorSharingViolation {
+			return nil, errLocked
+		}
+		return nil, err
+	}
+	return os.NewFile(uintptr(h), path), nil
+}
@@ -0,0 +1,580 @@
+package fileid
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gookit/slog"
+	"github.com/inherelab/genid/mysqlid"
+)
+
+const (
+	// LogFileName the append-only log file name
+	LogFileName = "genid.wal"
+	// LockFileName the lock file name, only one process can open the directory
+	LockFileName = "genid.lock"
+	// CompactCount the default records count of trigger compact the log
+	CompactCount = 10000
+	// CompactSize the default appended bytes of trigger compact the log
+	CompactSize = 16 << 20
+)
+
+var (
+	// the directory is locked by another process
+	errLocked = errors.New("locked by another process")
+	// the log file can not be appended, the storage refuses the writes until restart
+	errFailed = errors.New("file: the log file is broken, restart the storage for recover it")
+)
+
+// the log record operations
+const (
+	opSet   = "set"
+	opAlloc = "alloc"
+	opOpts  = "opts"
+	opDel   = "del"
+	opLease = "lease"
+)
+
+// record an append-only log record. one json per line.
+type record struct {
+	Op   string `json:"op"`
+	Key  string `json:"k"`
+	Id   int64  `json:"id,omitempty"`
+	Opts string `json:"opts,omitempty"`
+	// the range lease of the opLease record, saved or reported
+	Lease *mysqlid.RangeLease `json:"lease,omitempty"`
+}
+
+// the state of a key
+type keyState struct {
+	id   int64
+	opts string
+}
+
+// Config for the file storage
+type Config struct {
+	// Dir the directory of the log file
+	Dir string `mapstructure:"dir" yaml:"dir"`
+	// CompactCount compact the log on the appended records count reached it. default is CompactCount
+	CompactCount int `mapstructure:"compact_count" yaml:"compact_count"`
+	// CompactSize compact the log on the appended bytes since the last compaction reached it. default is CompactSize
+	CompactSize int64 `mapstructure:"compact_size" yaml:"compact_size"`
+}
+
+// Storage the local file storage. the high-water mark of each key is persisted to an append-only log,
+// and the log is fsync'd before a range is handed out. so it does not generate repetitive ids after crash.
+// the directory is locked on Init, so only one process can use it.
+type Storage struct {
+	lock sync.Mutex
+	dir  string
+	file *os.File
+	// the locked file, release the lock on Close
+	lockFile *os.File
+
+	// the rename of the log file is not durable, sync the directory before the next write returned
+	dirDirty bool
+
+	// records count in the log file and the appended bytes since the last compaction, for trigger compact
+	records      int
+	compactCount int
+	appended     int64
+	compactSize  int64
+
+	keys map[string]*keyState
+	// the range leases, and the last lease id
+	leases  []*mysqlid.RangeLease
+	leaseId int64
+}
+
+var (
+	_ mysqlid.Storage     = (*Storage)(nil)
+	_ mysqlid.RangeLeaser = (*Storage)(nil)
+)
+
+// NewStorage instance
+func NewStorage(c *Config) (*Storage, error) {
+	if c.Dir == "" {
+		return nil, fmt.Errorf("file: the log directory is required")
+	}
+
+	s := &Storage{
+		dir:          c.Dir,
+		compactCount: c.CompactCount,
+		compactSize:  c.CompactSize,
+		keys:         make(map[string]*keyState),
+	}
+
+	if s.compactCount <= 0 {
+		s.compactCount = CompactCount
+	}
+	if s.compactSize <= 0 {
+		s.compactSize = CompactSize
+	}
+	return s, nil
+}
+
+func (s *Storage) logFile() string {
+	return filepath.Join(s.dir, LogFileName)
+}
+
+// Init lock the directory, recover the keys state from the log file, and open it for append.
+// returns error if the directory is used by another process.
+func (s *Storage) Init() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.file != nil {
+		return nil
+	}
+
+	// the log file is broken, recover it again
+	s.unlock()
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+
+	lf, err := lockFile(filepath.Join(s.dir, LockFileName))
+	if err != nil {
+		return fmt.Errorf("file: lock the directory %s error: %s", s.dir, err.Error())
+	}
+	s.lockFile = lf
+
+	// rewrite the log, drop the broken tail record
+	if err = s.recover(); err == nil {
+		err = s.compact()
+	}
+	if err != nil {
+		s.unlock()
+	}
+	return err
+}
+
+// release the lock of the directory
+func (s *Storage) unlock() {
+	if s.lockFile != nil {
+		s.lockFile.Close()
+		s.lockFile = nil
+	}
+}
+
+// recover the keys state from the log file
+func (s *Storage) recover() error {
+	f, err := os.Open(s.logFile())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// the broken record is only allowed on the last line
+	var broken error
+	s.keys = make(map[string]*keyState)
+	s.leases, s.leaseId = nil, 0
+	reader := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		bs, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// the last record without the line end, is not written completely on crash.
+			if len(bs) > 0 {
+				slog.Warnf("file: drop the incomplete record at line %d of the log", line)
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if broken != nil {
+			return fmt.Errorf("file: %s", broken.Error())
+		}
+
+		r := &record{}
+		if err = json.Unmarshal(bs, r); err != nil {
+			broken = fmt.Errorf("broken record at line %d of the log: %s", line, err.Error())
+			continue
+		}
+
+		s.apply(r)
+	}
+
+	// the last record is torn on crash
+	if broken != nil {
+		slog.Warnf("file: drop the torn %s", broken.Error())
+	}
+
+	slog.Infof("file: recovered %d keys from the log %s", len(s.keys), s.logFile())
+	return nil
+}
+
+// apply the record to the keys state
+func (s *Storage) apply(r *record) {
+	switch r.Op {
+	case opSet, opAlloc:
+		st, ok := s.keys[r.Key]
+		if !ok {
+			st = &keyState{}
+			s.keys[r.Key] = st
+		}
+
+		st.id = r.Id
+		if r.Op == opSet && r.Opts != "" {
+			st.opts = r.Opts
+		}
+	case opOpts:
+		if st, ok := s.keys[r.Key]; ok {
+			st.opts = r.Opts
+		}
+	case opDel:
+		delete(s.keys, r.Key)
+	case opLease:
+		s.applyLease(r.Lease)
+	}
+}
+
+// replace the lease by id, or add it
+func (s *Storage) applyLease(lease *mysqlid.RangeLease) {
+	if lease == nil {
+		return
+	}
+
+	l := *lease
+	if l.Id > s.leaseId {
+		s.leaseId = l.Id
+	}
+
+	for i, old := range s.leases {
+		if old.Id == l.Id {
+			s.leases[i] = &l
+			return
+		}
+	}
+	s.leases = append(s.leases, &l)
+}
+
+// append the record to the log, and fsync it. then apply it to the keys state.
+// on the write failed, truncate the log to the offset before it, so no torn record is left in the middle.
+func (s *Storage) append(r *record) error {
+	if s.file == nil {
+		return errFailed
+	}
+
+	bs, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	fi, err := s.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	n, err := s.file.Write(append(bs, '\n'))
+	if err == nil {
+		err = s.file.Sync()
+	}
+	if err == nil && s.dirDirty {
+		err = syncDir(s.dir)
+		s.dirDirty = err != nil
+	}
+	if err != nil {
+		s.truncate(fi.Size())
+		return err
+	}
+
+	s.apply(r)
+	s.records++
+	s.appended += int64(n)
+	if s.records >= s.compactCount || s.appended >= s.compactSize {
+		return s.compact()
+	}
+	return nil
+}
+
+// truncate the log to the size, close it if failed. must be called on locked.
+func (s *Storage) truncate(size int64) {
+	err := s.file.Truncate(size)
+	if err == nil {
+		err = s.file.Sync()
+	}
+	if err != nil {
+		slog.Errorf("file: truncate the log to %d error: %s", size, err.Error())
+		s.file.Close()
+		s.file = nil
+	}
+}
+
+// Compact rewrite the log file with the latest state of each key
+func (s *Storage) Compact() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.compact()
+}
+
+func (s *Storage) compact() error {
+	tmpFile := s.logFile() + ".tmp"
+	f, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(s.keys))
+	for key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	w := bufio.NewWriter(f)
+	for _, key := range keys {
+		st := s.keys[key]
+		bs, _ := json.Marshal(&record{Op: opSet, Key: key, Id: st.id, Opts: st.opts})
+		w.Write(append(bs, '\n'))
+	}
+	for _, l := range s.leases {
+		bs, _ := json.Marshal(&record{Op: opLease, Lease: l})
+		w.Write(append(bs, '\n'))
+	}
+
+	if err = w.Flush(); err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	// replace the log file, and reopen it at once, the old file is unlinked.
+	if err = os.Rename(tmpFile, s.logFile()); err != nil {
+		return err
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+
+	s.file, err = os.OpenFile(s.logFile(), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		s.file = nil
+		return err
+	}
+
+	// sync the directory for make the rename durable, retry on the next write if failed.
+	if err = syncDir(s.dir); err != nil {
+		s.dirDirty = true
+		return err
+	}
+	s.dirDirty = false
+
+	slog.Debugf("file: compacted the log, keys: %d records: %d appended: %d", len(keys), s.records, s.appended)
+	s.records = len(keys) + len(s.leases)
+	s.appended = 0
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// Close the log file, and release the lock of the directory
+func (s *Storage) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// the lock is kept after the log file is broken
+	defer s.unlock()
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// Keys list all service keys
+func (s *Storage) Keys() ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	keys := make([]string, 0, len(s.keys))
+	for key := range s.keys {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Exists check the key is exists
+func (s *Storage) Exists(key string) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, ok := s.keys[key]
+	return ok, nil
+}
+
+// Current get the high-water mark of the key
+func (s *Storage) Current(key string) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if st, ok := s.keys[key]; ok {
+		return st.id, nil
+	}
+	return 0, nil
+}
+
+// Alloc allocate an id range of size for the key. returns the range start
+func (s *Storage) Alloc(key string, size int64) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	st, ok := s.keys[key]
+	if !ok {
+		return 0, fmt.Errorf("%s: have no id name", key)
+	}
+
+	start := st.id
+	if err := s.append(&record{Op: opAlloc, Key: key, Id: start + size}); err != nil {
+		return 0, err
+	}
+	return start, nil
+}
+
+// Wrap reset the key id to id, only if the current id is not less than the threshold
+func (s *Storage) Wrap(key string, threshold, id int64) (int64, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	st, ok := s.keys[key]
+	if !ok {
+		return 0, false, fmt.Errorf("%s: have no id name", key)
+	}
+
+	if st.id < threshold {
+		return st.id, false, nil
+	}
+
+	if err := s.append(&record{Op: opSet, Key: key, Id: id, Opts: st.opts}); err != nil {
+		return 0, false, err
+	}
+	return id, true, nil
+}
+
+// Reset the key id. if the key exists and force=false, will not change the id.
+func (s *Storage) Reset(key string, idOffset int64, force bool) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	st, ok := s.keys[key]
+	// NOTICE: dont update id value to `idOffset`.
+	if ok && !force {
+		return st.id, nil
+	}
+
+	var opts string
+	if ok {
+		opts = st.opts
+	}
+
+	if err := s.append(&record{Op: opSet, Key: key, Id: idOffset, Opts: opts}); err != nil {
+		return 0, err
+	}
+	return idOffset, nil
+}
+
+// Delete the key
+func (s *Storage) Delete(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.keys[key]; !ok {
+		return nil
+	}
+	return s.append(&record{Op: opDel, Key: key})
+}
+
+// Options get service options of the key
+func (s *Storage) Options(key string) (*mysqlid.Options, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var str string
+	if st, ok := s.keys[key]; ok {
+		str = st.opts
+	}
+	return mysqlid.ParseOptions(str)
+}
+
+// SaveOptions save service options of the key
+func (s *Storage) SaveOptions(key string, opts *mysqlid.Options) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.keys[key]; !ok {
+		return mysqlid.ErrKeyNotExists
+	}
+	return s.append(&record{Op: opOpts, Key: key, Opts: opts.String()})
+}
+
+// SaveLease record the leased range to the log
+func (s *Storage) SaveLease(lease *mysqlid.RangeLease) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	l := *lease
+	l.Id = s.leaseId + 1
+	if err := s.append(&record{Op: opLease, Key: l.Key, Lease: &l}); err != nil {
+		return err
+	}
+
+	lease.Id = l.Id
+	return nil
+}
+
+// ReportLease update the consumed count of the lease
+func (s *Storage) ReportLease(id, used int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, old := range s.leases {
+		if old.Id == id {
+			l := *old
+			l.Used = used
+			l.ReportedAt = time.Now()
+			return s.append(&record{Op: opLease, Key: l.Key, Lease: &l})
+		}
+	}
+	return mysqlid.ErrLeaseNotExists
+}
+
+// Leases list the range leases of the key
+func (s *Storage) Leases(key string) ([]*mysqlid.RangeLease, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var leases []*mysqlid.RangeLease
+	for _, l := range s.leases {
+		if l.Key == key {
+			cp := *l
+			leases = append(leases, &cp)
+		}
+	}
+	return leases, nil
+}
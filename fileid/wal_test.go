@@ -0,0 +1,212 @@
+package fileid_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/inherelab/genid/fileid"
+	"github.com/inherelab/genid/idtest"
+	"github.com/inherelab/genid/mysqlid"
+)
+
+func TestStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genid-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// only one storage can open the directory, close the last opened storage on reopen
+	var last *fileid.Storage
+	defer func() {
+		if last != nil {
+			last.Close()
+		}
+	}()
+
+	idtest.RunStorage(t, func(t *testing.T) mysqlid.Storage {
+		if last != nil {
+			last.Close()
+		}
+
+		// small compact count, for compact the log on testing
+		store, err := fileid.NewStorage(&fileid.Config{Dir: dir, CompactCount: 20})
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = store
+		return store
+	})
+}
+
+func TestStorage_lock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genid-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store1, _ := fileid.NewStorage(&fileid.Config{Dir: dir})
+	if err = store1.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	store2, _ := fileid.NewStorage(&fileid.Config{Dir: dir})
+	if err = store2.Init(); err == nil {
+		t.Fatal("should returns error on the directory is used by another storage")
+	}
+
+	// the lock is released on close
+	store1.Close()
+	if err = store2.Init(); err != nil {
+		t.Fatal(err)
+	}
+	store2.Close()
+}
+
+func TestStorage_compactSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genid-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, _ := fileid.NewStorage(&fileid.Config{Dir: dir, CompactSize: 4096})
+	if err = store.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if _, err = store.Reset("order", 0, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// the large options records trigger the compaction before the compact count reached
+	opts := &mysqlid.Options{Format: strings.Repeat("x", 1000) + "{seq}"}
+	for i := 0; i < 50; i++ {
+		if err = store.SaveOptions("order", opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fi, err := os.Stat(filepath.Join(dir, fileid.LogFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() > 4096+2048 {
+		t.Fatalf("the log should be compacted on the size reached, but the size is %d", fi.Size())
+	}
+}
+
+func TestStorage_incompleteRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genid-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, _ := fileid.NewStorage(&fileid.Config{Dir: dir})
+	if err = store.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Reset("order", 100, true); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// crash on writing the record
+	f, err := os.OpenFile(filepath.Join(dir, fileid.LogFileName), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"op":"alloc","k":"order","id":2`)
+	f.Close()
+
+	store, _ = fileid.NewStorage(&fileid.Config{Dir: dir})
+	if err = store.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if id, _ := store.Current("order"); id != 100 {
+		t.Fatalf("the current id should be 100, but got %d", id)
+	}
+	if start, _ := store.Alloc("order", 10); start != 100 {
+		t.Fatalf("the range start should be 100, but got %d", start)
+	}
+}
+
+func TestStorage_tornRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genid-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logFile := filepath.Join(dir, fileid.LogFileName)
+	valid := `{"op":"set","k":"order","id":100}` + "\n"
+
+	// the torn last record is dropped
+	if err = ioutil.WriteFile(logFile, []byte(valid+"\x00\x00\x00\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store, _ := fileid.NewStorage(&fileid.Config{Dir: dir})
+	if err = store.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := store.Current("order"); id != 100 {
+		t.Fatalf("the current id should be 100, but got %d", id)
+	}
+	store.Close()
+
+	// the broken record in the middle is not dropped
+	if err = ioutil.WriteFile(logFile, []byte(valid+"\x00\x00\x00\n"+valid), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store, _ = fileid.NewStorage(&fileid.Config{Dir: dir})
+	if err = store.Init(); err == nil || !strings.Contains(err.Error(), "broken record at line 2") {
+		t.Fatalf("should returns error on the broken record in the middle, got %v", err)
+	}
+}
+
+func TestStorage_failedWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genid-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, _ := fileid.NewStorage(&fileid.Config{Dir: dir})
+	if err = store.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Reset("order", 100, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// the write failed, and the log can't be truncated. refuse the writes until reopen
+	if err = fileid.ReadOnlyLog(store); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = store.Alloc("order", 10); err == nil {
+		t.Fatal("should returns error on the write failed")
+	}
+	if _, err = store.Alloc("order", 10); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Fatalf("should refuse the writes after the write failed, got %v", err)
+	}
+	if id, _ := store.Current("order"); id != 100 {
+		t.Fatalf("the failed alloc should not be applied, but the current id is %d", id)
+	}
+
+	store.Close()
+	if err = store.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if start, err := store.Alloc("order", 10); err != nil || start != 100 {
+		t.Fatalf("the range start should be 100 after reopen, but got %d, err: %v", start, err)
+	}
+}
@@ -11,3 +11,9 @@ type GeneratorFace interface {
 	Current() int64
 	Next() (int64, error)
 }
+
+// StringGeneratorFace interface, for the generators of the string ids. eg: ULID, UUID
+type StringGeneratorFace interface {
+	CurrentString() string
+	NextString() (string, error)
+}
@@ -9,4 +9,6 @@ require (
 	github.com/gookit/gcli/v2 v2.3.4
 	github.com/gookit/goutil v0.6.9
 	github.com/gookit/slog v0.5.1
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.22
 )
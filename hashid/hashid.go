@@ -0,0 +1,258 @@
+// Package hashid encode the sequential ids to the short, reversible and non-guessable strings.
+//
+// the encoding is compatible with the Hashids(https://hashids.org) for the single number.
+// the salt makes the strings different between the services, keep it secret.
+package hashid
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	// DefaultAlphabet the default alphabet of the encoded string
+	DefaultAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890"
+	// MinAlphabetLength the min count of the unique chars in the alphabet
+	MinAlphabetLength = 16
+	// MaxMinLength the max value of the min length of the encoded string
+	MaxMinLength = 64
+
+	defaultSeps = "cfhistuCFHISTU"
+	sepDiv      = 3.5
+	guardDiv    = 12
+)
+
+// ErrInvalidHash the string is not encoded by the encoder
+var ErrInvalidHash = errors.New("invalid hash id")
+
+// Encoder the reversible id encoder. it's safe for concurrent use.
+type Encoder struct {
+	salt      []rune
+	minLength int
+	alphabet  []rune
+	seps      []rune
+	guards    []rune
+}
+
+// New create the encoder. the alphabet is DefaultAlphabet if empty.
+func New(salt, alphabet string, minLength int) (*Encoder, error) {
+	if alphabet == "" {
+		alphabet = DefaultAlphabet
+	}
+	if minLength < 0 || minLength > MaxMinLength {
+		return nil, fmt.Errorf("hashid: the min length must be in 0 ~ %d", MaxMinLength)
+	}
+
+	chars := make([]rune, 0, len(alphabet))
+	seen := make(map[rune]bool, len(alphabet))
+	for _, r := range alphabet {
+		if r == ' ' {
+			return nil, errors.New("hashid: the alphabet can not contains spaces")
+		}
+		if seen[r] {
+			return nil, fmt.Errorf("hashid: the alphabet contains the duplicate char %q", r)
+		}
+		seen[r] = true
+		chars = append(chars, r)
+	}
+	if len(chars) < MinAlphabetLength {
+		return nil, fmt.Errorf("hashid: the alphabet must contains at least %d unique chars", MinAlphabetLength)
+	}
+
+	e := &Encoder{salt: []rune(salt), minLength: minLength}
+
+	// the separators are the chars of the alphabet in defaultSeps
+	var seps, rest []rune
+	for _, r := range chars {
+		if strings.ContainsRune(defaultSeps, r) {
+			seps = append(seps, r)
+		} else {
+			rest = append(rest, r)
+		}
+	}
+	shuffle(seps, e.salt)
+
+	if len(seps) == 0 || float64(len(rest))/float64(len(seps)) > sepDiv {
+		sepsLength := int(math.Ceil(float64(len(rest)) / sepDiv))
+		if sepsLength == 1 {
+			sepsLength = 2
+		}
+		if sepsLength > len(seps) {
+			diff := sepsLength - len(seps)
+			seps = append(seps, rest[:diff]...)
+			rest = rest[diff:]
+		} else {
+			seps = seps[:sepsLength]
+		}
+	}
+	shuffle(rest, e.salt)
+
+	guardCount := int(math.Ceil(float64(len(rest)) / guardDiv))
+	if len(rest) < 3 {
+		e.guards, seps = seps[:guardCount], seps[guardCount:]
+	} else {
+		e.guards, rest = rest[:guardCount], rest[guardCount:]
+	}
+
+	e.alphabet, e.seps = rest, seps
+	return e, nil
+}
+
+// Encode the id to string. the id must be not negative.
+func (e *Encoder) Encode(id int64) (string, error) {
+	if id < 0 {
+		return "", errors.New("hashid: can not encode the negative id")
+	}
+
+	alphabet := make([]rune, len(e.alphabet))
+	copy(alphabet, e.alphabet)
+
+	numHash := id % 100
+	lottery := alphabet[numHash%int64(len(alphabet))]
+	ret := []rune{lottery}
+
+	buffer := make([]rune, 0, 1+len(e.salt)+len(alphabet))
+	buffer = append(buffer, lottery)
+	buffer = append(buffer, e.salt...)
+	buffer = append(buffer, alphabet...)
+	shuffle(alphabet, buffer[:len(alphabet)])
+	ret = append(ret, hash(id, alphabet)...)
+
+	if len(ret) < e.minLength {
+		idx := (numHash + int64(ret[0])) % int64(len(e.guards))
+		ret = append([]rune{e.guards[idx]}, ret...)
+
+		if len(ret) < e.minLength {
+			idx = (numHash + int64(ret[2])) % int64(len(e.guards))
+			ret = append(ret, e.guards[idx])
+		}
+	}
+
+	half := len(alphabet) / 2
+	for len(ret) < e.minLength {
+		salt := make([]rune, len(alphabet))
+		copy(salt, alphabet)
+		shuffle(alphabet, salt)
+
+		padded := make([]rune, 0, len(ret)+len(alphabet))
+		padded = append(padded, alphabet[half:]...)
+		padded = append(padded, ret...)
+		padded = append(padded, alphabet[:half]...)
+		ret = padded
+
+		if excess := len(ret) - e.minLength; excess > 0 {
+			ret = ret[excess/2 : excess/2+e.minLength]
+		}
+	}
+
+	return string(ret), nil
+}
+
+// Decode the string to id. returns ErrInvalidHash if the string is not encoded by the encoder.
+func (e *Encoder) Decode(s string) (int64, error) {
+	runes := []rune(s)
+	if len(runes) == 0 {
+		return 0, ErrInvalidHash
+	}
+
+	// remove the guards and the padding
+	parts := splitRunes(runes, e.guards)
+	part := parts[0]
+	if len(parts) == 2 || len(parts) == 3 {
+		part = parts[1]
+	}
+	if len(part) < 2 {
+		return 0, ErrInvalidHash
+	}
+
+	// only the single number is supported
+	nums := splitRunes(part[1:], e.seps)
+	if len(nums) != 1 {
+		return 0, ErrInvalidHash
+	}
+
+	alphabet := make([]rune, len(e.alphabet))
+	copy(alphabet, e.alphabet)
+
+	buffer := make([]rune, 0, 1+len(e.salt)+len(alphabet))
+	buffer = append(buffer, part[0])
+	buffer = append(buffer, e.salt...)
+	buffer = append(buffer, alphabet...)
+	shuffle(alphabet, buffer[:len(alphabet)])
+
+	id, ok := unhash(nums[0], alphabet)
+	if !ok {
+		return 0, ErrInvalidHash
+	}
+
+	// the string must be same as encoded
+	if enc, err := e.Encode(id); err != nil || enc != s {
+		return 0, ErrInvalidHash
+	}
+	return id, nil
+}
+
+// the consistent shuffle of the alphabet by the salt
+func shuffle(alphabet, salt []rune) {
+	if len(salt) == 0 {
+		return
+	}
+
+	for i, v, p := len(alphabet)-1, 0, 0; i > 0; i-- {
+		v %= len(salt)
+		asc := int(salt[v])
+		p += asc
+		j := (asc + v + p) % i
+		alphabet[i], alphabet[j] = alphabet[j], alphabet[i]
+		v++
+	}
+}
+
+func hash(id int64, alphabet []rune) []rune {
+	size := int64(len(alphabet))
+	var ret []rune
+	for {
+		ret = append([]rune{alphabet[id%size]}, ret...)
+		id /= size
+		if id == 0 {
+			return ret
+		}
+	}
+}
+
+func unhash(input, alphabet []rune) (int64, bool) {
+	size := int64(len(alphabet))
+	var id int64
+	for _, r := range input {
+		pos := indexRune(alphabet, r)
+		if pos < 0 || id > (math.MaxInt64-int64(pos))/size {
+			return 0, false
+		}
+		id = id*size + int64(pos)
+	}
+	return id, true
+}
+
+// split the runes by any of the separators
+func splitRunes(runes, seps []rune) [][]rune {
+	parts := make([][]rune, 0, 3)
+	last := 0
+	for i, r := range runes {
+		if indexRune(seps, r) >= 0 {
+			parts = append(parts, runes[last:i])
+			last = i + 1
+		}
+	}
+	return append(parts, runes[last:])
+}
+
+func indexRune(runes []rune, r rune) int {
+	for i, c := range runes {
+		if c == r {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,78 @@
+package hashid_test
+
+import (
+	"testing"
+
+	"github.com/inherelab/genid/hashid"
+)
+
+func TestEncoder(t *testing.T) {
+	tests := []struct {
+		salt      string
+		minLength int
+		id        int64
+		want      string
+	}{
+		// the results of the Hashids
+		{"this is my salt", 0, 12345, "NkK9"},
+		{"this is my salt", 8, 1, "gB0NV05e"},
+		{"", 0, 0, "gY"},
+	}
+
+	for _, tt := range tests {
+		enc, err := hashid.New(tt.salt, "", tt.minLength)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s, err := enc.Encode(tt.id)
+		if err != nil || s != tt.want {
+			t.Fatalf("encode %d should be %s, but got %s, err: %v", tt.id, tt.want, s, err)
+		}
+		if id, err := enc.Decode(s); err != nil || id != tt.id {
+			t.Fatalf("decode %s should be %d, but got %d, err: %v", s, tt.id, id, err)
+		}
+	}
+}
+
+func TestEncoder_roundTrip(t *testing.T) {
+	enc, err := hashid.New("service_order", "0123456789abcdefghijklmnopqrstuvwxyz", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[string]bool)
+	for _, id := range []int64{0, 1, 2, 99, 100, 1 << 32, 1<<63 - 1} {
+		s, err := enc.Encode(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(s) < 10 || seen[s] {
+			t.Fatalf("invalid encoded string %s of %d", s, id)
+		}
+		seen[s] = true
+
+		if got, err := enc.Decode(s); err != nil || got != id {
+			t.Fatalf("decode %s should be %d, but got %d, err: %v", s, id, got, err)
+		}
+	}
+
+	other, _ := hashid.New("service_user", "0123456789abcdefghijklmnopqrstuvwxyz", 10)
+	s, _ := enc.Encode(123)
+	if s2, _ := other.Encode(123); s2 == s {
+		t.Fatal("the encoded strings should be different by the salt")
+	}
+
+	for _, s := range []string{"", "a", "!!!!!!!!!!", s + "x"} {
+		if _, err = enc.Decode(s); err != hashid.ErrInvalidHash {
+			t.Fatalf("decode %q should returns ErrInvalidHash, got %v", s, err)
+		}
+	}
+
+	if _, err = hashid.New("", "abcdefg", 0); err == nil {
+		t.Fatal("should returns error on the short alphabet")
+	}
+	if _, err = hashid.New("", "aabcdefghijklmnopq", 0); err == nil {
+		t.Fatal("should returns error on the duplicate chars")
+	}
+}
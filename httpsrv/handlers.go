@@ -1,3 +1,526 @@
 package httpsrv
 
-// TODO command handlers
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gookit/slog"
+	"github.com/inherelab/genid/hashid"
+	"github.com/inherelab/genid/mysqlid"
+)
+
+// Response struct
+type Response struct {
+	Code int         `json:"code"`
+	Msg  string      `json:"msg"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// IdValue struct
+type IdValue struct {
+	Name string `json:"name"`
+	Id   int64  `json:"id"`
+	// Formatted the id formatted by the template, see mysqlid.Template
+	Formatted string `json:"formatted,omitempty"`
+	// Encoded the reversible encoded id, see hashid.Encoder
+	Encoded string `json:"encoded,omitempty"`
+}
+
+// StrIdValue struct, for the services generate the string ids. eg: ulid, uuidv7
+type StrIdValue struct {
+	Name string `json:"name"`
+	Id   string `json:"id"`
+}
+
+// IdList struct
+type IdList struct {
+	Name string  `json:"name"`
+	Ids  []int64 `json:"ids"`
+	// Formatted the ids formatted by the template
+	Formatted []string `json:"formatted,omitempty"`
+	// Encoded the reversible encoded ids
+	Encoded []string `json:"encoded,omitempty"`
+}
+
+// StrIdList struct, for the services generate the string ids.
+type StrIdList struct {
+	Name string   `json:"name"`
+	Ids  []string `json:"ids"`
+}
+
+func (s *Server) newMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/next", s.handleNext)
+	mux.HandleFunc("/mnext", s.handleMultiNext)
+	mux.HandleFunc("/decode", s.handleDecode)
+	mux.HandleFunc("/current", s.handleCurrent)
+	mux.HandleFunc("/exists", s.handleExists)
+	mux.HandleFunc("/list", s.handleList)
+	mux.HandleFunc("/set", s.handleSet)
+	mux.HandleFunc("/mset", s.handleMultiSet)
+	mux.HandleFunc("/del", s.handleDel)
+	mux.HandleFunc("/lease", s.handleLease)
+	mux.HandleFunc("/lease/report", s.handleLeaseReport)
+	mux.HandleFunc("/leases", s.handleLeases)
+	mux.HandleFunc("/ledger", s.handleLedger)
+
+	return mux
+}
+
+// GET /next?name=service_user
+func (s *Server) handleNext(w http.ResponseWriter, r *http.Request) {
+	name, err := serviceName(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if s.IsStringService(name) {
+		id, err := s.NextString(name)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+
+		writeData(w, &StrIdValue{Name: name, Id: id})
+		return
+	}
+
+	if encodeParam(r) {
+		id, str, err := s.NextEncoded(name)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+
+		writeData(w, &IdValue{Name: name, Id: id, Encoded: str})
+		return
+	}
+
+	tpl, ok, err := s.formatTemplate(r, name)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if ok {
+		id, str, err := s.NextFormatted(name, tpl)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+
+		writeData(w, &IdValue{Name: name, Id: id, Formatted: str})
+		return
+	}
+
+	id, err := s.NextId(name)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeData(w, &IdValue{Name: name, Id: id})
+}
+
+// GET /mnext?name=service_user&count=100
+func (s *Server) handleMultiNext(w http.ResponseWriter, r *http.Request) {
+	name, err := serviceName(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	count, err := strconv.Atoi(r.URL.Query().Get("count"))
+	if err != nil || count < 1 || count > mysqlid.MaxBulkCount {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("count must be an integer in 1 ~ %d", mysqlid.MaxBulkCount))
+		return
+	}
+
+	if s.IsStringService(name) {
+		ids, err := s.NextStrings(name, count)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+
+		writeData(w, &StrIdList{Name: name, Ids: ids})
+		return
+	}
+
+	if encodeParam(r) {
+		ids, strs, err := s.NextEncodedN(name, count)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+
+		writeData(w, &IdList{Name: name, Ids: ids, Encoded: strs})
+		return
+	}
+
+	tpl, ok, err := s.formatTemplate(r, name)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if ok {
+		ids, strs, err := s.NextFormattedN(name, tpl, count)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+
+		writeData(w, &IdList{Name: name, Ids: ids, Formatted: strs})
+		return
+	}
+
+	ids, err := s.NextIds(name, count)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeData(w, &IdList{Name: name, Ids: ids})
+}
+
+// GET /decode?name=service_user&id=gY
+func (s *Server) handleDecode(w http.ResponseWriter, r *http.Request) {
+	name, err := serviceName(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	str := r.URL.Query().Get("id")
+	id, err := s.DecodeId(name, str)
+	if err != nil {
+		if err == hashid.ErrInvalidHash {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		writeServiceError(w, err)
+		return
+	}
+
+	writeData(w, &IdValue{Name: name, Id: id, Encoded: str})
+}
+
+// GET /current?name=service_user
+func (s *Server) handleCurrent(w http.ResponseWriter, r *http.Request) {
+	name, err := serviceName(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if s.IsStringService(name) {
+		id, err := s.CurrentString(name)
+		if err != nil {
+			writeServiceError(w, err)
+			return
+		}
+
+		writeData(w, &StrIdValue{Name: name, Id: id})
+		return
+	}
+
+	id, err := s.CurrentId(name)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeData(w, &IdValue{Name: name, Id: id})
+}
+
+// GET /exists?name=service_user
+func (s *Server) handleExists(w http.ResponseWriter, r *http.Request) {
+	name, err := serviceName(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeData(w, s.ServiceExists(name))
+}
+
+// GET /list
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	writeData(w, s.ListServices())
+}
+
+// POST /set {"name": "service_user", "value": 2300, "force": false, "batch": 5000}
+func (s *Server) handleSet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	vs := &ValueSet{}
+	if err := json.NewDecoder(r.Body).Decode(vs); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ret, err := s.setValue(vs, vs.Force)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeData(w, ret)
+}
+
+// POST /lease {"name": "service_user", "count": 10000, "client": "importer-1"}
+func (s *Server) handleLease(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	lr := &LeaseRequest{}
+	if err := json.NewDecoder(r.Body).Decode(lr); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	name, err := mysqlid.GoodServiceKey(lr.Name)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if lr.Count < 1 || lr.Count > mysqlid.MaxLeaseCount {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("count must be in 1 ~ %d", mysqlid.MaxLeaseCount))
+		return
+	}
+
+	lease, err := s.LeaseRange(name, lr.Client, lr.Count)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeData(w, lease)
+}
+
+// POST /lease/report {"id": 12, "used": 5000}
+func (s *Server) handleLeaseReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	lr := &LeaseReport{}
+	if err := json.NewDecoder(r.Body).Decode(lr); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.ReportLease(lr.Id, lr.Used); err != nil {
+		if err == mysqlid.ErrLeaseNotExists {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeData(w, true)
+}
+
+// GET /leases?name=service_user
+func (s *Server) handleLeases(w http.ResponseWriter, r *http.Request) {
+	name, err := serviceName(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	leases, err := s.ListLeases(name)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeData(w, leases)
+}
+
+// GET /ledger?name=service_user&id=12345&limit=100, query the ledger of the ids allocation.
+// all params are optional, the id filters the entries which range contains it.
+func (s *Server) handleLedger(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := &mysqlid.LedgerQuery{Key: strings.TrimSpace(query.Get("name"))}
+
+	var err error
+	if str := query.Get("id"); str != "" {
+		if q.IdIn, err = strconv.ParseInt(str, 10, 64); err != nil || q.IdIn < 1 {
+			writeError(w, http.StatusBadRequest, errors.New("id must be a positive integer"))
+			return
+		}
+	}
+	if str := query.Get("limit"); str != "" {
+		if q.Limit, err = strconv.Atoi(str); err != nil || q.Limit < 1 || q.Limit > mysqlid.MaxLedgerLimit {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("limit must be an integer in 1 ~ %d", mysqlid.MaxLedgerLimit))
+			return
+		}
+	}
+
+	entries, err := s.LedgerEntries(q)
+	if err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeData(w, entries)
+}
+
+// POST /mset {"force": false, "values": [{"name": "service_user", "value": 2300}]}
+func (s *Server) handleMultiSet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	ms := &MultiSet{}
+	if err := json.NewDecoder(r.Body).Decode(ms); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if len(ms.Values) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("values is required"))
+		return
+	}
+
+	ret := make([]*IdValue, 0, len(ms.Values))
+	for _, vs := range ms.Values {
+		iv, err := s.setValue(vs, ms.Force || vs.Force)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		ret = append(ret, iv)
+	}
+
+	writeData(w, ret)
+}
+
+// POST /del {"name": "service_user"}
+func (s *Server) handleDel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	name, err := serviceName(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err = s.DelService(name); err != nil {
+		writeServiceError(w, err)
+		return
+	}
+
+	writeData(w, true)
+}
+
+func (s *Server) setValue(vs *ValueSet, force bool) (*IdValue, error) {
+	name, err := mysqlid.GoodServiceKey(vs.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if vs.Value < 1 {
+		return nil, errors.New("value must be greater than 0")
+	}
+
+	opts := make(map[string]string, len(vs.Options)+1)
+	for k, v := range vs.Options {
+		opts[k] = v
+	}
+	if vs.Batch != nil {
+		opts["batch"] = strconv.FormatInt(*vs.Batch, 10)
+	}
+
+	id, err := s.SetService(name, vs.Value, force, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IdValue{Name: name, Id: id}, nil
+}
+
+// get the format template by the query "format", or use the service option Format.
+// returns false if the ids should not be formatted.
+func (s *Server) formatTemplate(r *http.Request, name string) (string, bool, error) {
+	if vs, ok := r.URL.Query()["format"]; ok {
+		if vs[0] != "" {
+			if _, err := mysqlid.ParseTemplate(vs[0]); err != nil {
+				return "", false, err
+			}
+		}
+		return vs[0], true, nil
+	}
+
+	gen, err := s.GetGenerator(name)
+	if err != nil {
+		return "", false, nil
+	}
+
+	opts := gen.Options()
+	return "", opts.Format != "", nil
+}
+
+// the query "encode" is true, returns the encoded ids
+func encodeParam(r *http.Request) bool {
+	encode, _ := strconv.ParseBool(r.URL.Query().Get("encode"))
+	return encode
+}
+
+// get service name from query string, or the json body
+func serviceName(r *http.Request) (string, error) {
+	name := r.URL.Query().Get("name")
+	if name == "" && r.Body != nil && r.Method != http.MethodGet {
+		vg := &ValueGet{}
+		if err := json.NewDecoder(r.Body).Decode(vg); err == nil {
+			name = vg.Name
+		}
+	}
+
+	return mysqlid.GoodServiceKey(name)
+}
+
+func writeServiceError(w http.ResponseWriter, err error) {
+	if err == mysqlid.ErrServiceNotExists {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	writeError(w, http.StatusInternalServerError, err)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, &Response{Code: status, Msg: err.Error()})
+}
+
+func writeData(w http.ResponseWriter, data interface{}) {
+	writeJSON(w, http.StatusOK, &Response{Msg: "OK", Data: data})
+}
+
+func writeJSON(w http.ResponseWriter, status int, resp *Response) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		slog.Error("write response error", err)
+	}
+}
@@ -10,6 +10,10 @@ type ValueSet struct {
 	Name  string `json:"name" validate:"required|min_len:2"`
 	Value int64  `json:"value" validate:"required|min:1"`
 	Force bool   `json:"force"`
+	// Batch set the batch count of the service, if not nil.
+	Batch *int64 `json:"batch" validate:"min:0"`
+	// Options set options of the service. eg: {"max_batch": "100000"}
+	Options map[string]string `json:"options"`
 }
 
 // MultiSet struct
@@ -17,3 +21,16 @@ type MultiSet struct {
 	Force  bool        `json:"force"`
 	Values []*ValueSet `json:"values" validate:"required|min:1"`
 }
+
+// LeaseRequest struct
+type LeaseRequest struct {
+	Name   string `json:"name" validate:"required"`
+	Count  int64  `json:"count" validate:"required|min:1"`
+	Client string `json:"client"`
+}
+
+// LeaseReport struct
+type LeaseReport struct {
+	Id   int64 `json:"id" validate:"required"`
+	Used int64 `json:"used" validate:"min:0"`
+}
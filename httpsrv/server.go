@@ -18,13 +18,16 @@ type Server struct {
 
 // NewServer instance
 func NewServer(manager *mysqlid.Manager, addr string) *Server {
-	return &Server{
+	s := &Server{
 		Manager: manager,
 		// addr: addr,
 		hserver: &http.Server{
 			Addr: addr,
 		},
 	}
+
+	s.SetHandler(s.newMux())
+	return s
 }
 
 // SetHandler for http server
@@ -59,5 +62,10 @@ func (s *Server) Close() {
 		}
 	}
 
+	// release the leased worker id
+	if err := s.Manager.Close(); err != nil {
+		slog.Error(err)
+	}
+
 	slog.Info("redis server closed!")
 }
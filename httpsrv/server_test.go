@@ -0,0 +1,195 @@
+package httpsrv
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/inherelab/genid/mysqlid"
+)
+
+// the response with the raw data, decode the data by the endpoint
+type testResponse struct {
+	Code int             `json:"code"`
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+// create the server on the memory storage
+func newTestServer(t *testing.T) *Server {
+	mgr := mysqlid.NewManager(mysqlid.NewMemoryStorage())
+	if err := mgr.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewServer(mgr, "")
+}
+
+// do the request, check the status and decode the data to v
+func doRequest(t *testing.T, s *Server, method, url, body string, status int, v interface{}) {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	s.hserver.Handler.ServeHTTP(w, req)
+
+	resp := &testResponse{}
+	if err := json.NewDecoder(w.Body).Decode(resp); err != nil {
+		t.Fatalf("%s %s: decode the response error: %v", method, url, err)
+	}
+	if w.Code != status {
+		t.Fatalf("%s %s: the status should be %d, but got %d, msg: %s", method, url, status, w.Code, resp.Msg)
+	}
+
+	if v != nil {
+		if err := json.Unmarshal(resp.Data, v); err != nil {
+			t.Fatalf("%s %s: decode the data error: %v", method, url, err)
+		}
+	}
+}
+
+func TestServer_set(t *testing.T) {
+	s := newTestServer(t)
+
+	iv := &IdValue{}
+	doRequest(t, s, http.MethodPost, "/set", `{"name": "user", "value": 100, "batch": 50, "options": {"max_batch": "1000"}}`, http.StatusOK, iv)
+	if iv.Name != "user" || iv.Id != 100 {
+		t.Fatalf("invalid set result: %+v", iv)
+	}
+
+	gen, err := s.GetGenerator("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts := gen.Options(); opts.Batch != 50 || opts.MaxBatch != 1000 {
+		t.Fatalf("the batch and the options should be saved, got %+v", opts)
+	}
+
+	// the existing service is not changed without force
+	doRequest(t, s, http.MethodPost, "/set", `{"name": "user", "value": 500}`, http.StatusOK, iv)
+	if iv.Id != 100 {
+		t.Fatalf("the id should be kept 100, but got %d", iv.Id)
+	}
+	doRequest(t, s, http.MethodPost, "/set", `{"name": "user", "value": 500, "force": true}`, http.StatusOK, iv)
+	if iv.Id != 500 {
+		t.Fatalf("the id should be reset to 500, but got %d", iv.Id)
+	}
+
+	doRequest(t, s, http.MethodGet, "/set", "", http.StatusMethodNotAllowed, nil)
+	doRequest(t, s, http.MethodPost, "/set", `{"name": "user", "value": 0}`, http.StatusBadRequest, nil)
+	doRequest(t, s, http.MethodPost, "/set", `{"name": "user", "value": 1, "options": {"unknown": "1"}}`, http.StatusBadRequest, nil)
+}
+
+func TestServer_mset(t *testing.T) {
+	s := newTestServer(t)
+
+	var ret []*IdValue
+	doRequest(t, s, http.MethodPost, "/mset", `{"values": [{"name": "abc", "value": 100}, {"name": "def", "value": 200}]}`, http.StatusOK, &ret)
+	if len(ret) != 2 || ret[0].Id != 100 || ret[1].Id != 200 {
+		t.Fatalf("invalid mset result: %+v", ret)
+	}
+
+	// returns the current id of the existing service, the force of the request applies to all values
+	doRequest(t, s, http.MethodPost, "/mset", `{"values": [{"name": "abc", "value": 300}]}`, http.StatusOK, &ret)
+	if ret[0].Id != 100 {
+		t.Fatalf("the id should be kept 100, but got %d", ret[0].Id)
+	}
+	doRequest(t, s, http.MethodPost, "/mset", `{"force": true, "values": [{"name": "abc", "value": 300}]}`, http.StatusOK, &ret)
+	if ret[0].Id != 300 {
+		t.Fatalf("the id should be reset to 300, but got %d", ret[0].Id)
+	}
+
+	doRequest(t, s, http.MethodPost, "/mset", `{"values": []}`, http.StatusBadRequest, nil)
+	doRequest(t, s, http.MethodPost, "/mset", `{"values": [{"name": " ", "value": 1}]}`, http.StatusBadRequest, nil)
+}
+
+func TestServer_mnext(t *testing.T) {
+	s := newTestServer(t)
+	doRequest(t, s, http.MethodPost, "/set", `{"name": "user", "value": 100}`, http.StatusOK, nil)
+
+	list := &IdList{}
+	doRequest(t, s, http.MethodGet, "/mnext?name=user&count=3", "", http.StatusOK, list)
+	if len(list.Ids) != 3 || list.Ids[0] != 101 || list.Ids[2] != 103 {
+		t.Fatalf("the ids should be 101 ~ 103, got %v", list.Ids)
+	}
+
+	doRequest(t, s, http.MethodGet, "/mnext?name=user&count=2&format=U%7Bseq:06%7D", "", http.StatusOK, list)
+	if len(list.Formatted) != 2 || list.Formatted[0] != "U000104" {
+		t.Fatalf("the ids should be formatted, got %v", list.Formatted)
+	}
+
+	doRequest(t, s, http.MethodGet, "/mnext?name=user&count=0", "", http.StatusBadRequest, nil)
+	doRequest(t, s, http.MethodGet, "/mnext?name=user&count=x", "", http.StatusBadRequest, nil)
+	doRequest(t, s, http.MethodGet, "/mnext?name=missing&count=2", "", http.StatusNotFound, nil)
+}
+
+func TestServer_decode(t *testing.T) {
+	s := newTestServer(t)
+	doRequest(t, s, http.MethodPost, "/set", `{"name": "user", "value": 100, "options": {"salt": "abc"}}`, http.StatusOK, nil)
+
+	iv := &IdValue{}
+	doRequest(t, s, http.MethodGet, "/next?name=user&encode=true", "", http.StatusOK, iv)
+	if iv.Id != 101 || iv.Encoded == "" {
+		t.Fatalf("the id should be encoded, got %+v", iv)
+	}
+
+	decoded := &IdValue{}
+	doRequest(t, s, http.MethodGet, "/decode?name=user&id="+iv.Encoded, "", http.StatusOK, decoded)
+	if decoded.Id != iv.Id {
+		t.Fatalf("the decoded id should be %d, but got %d", iv.Id, decoded.Id)
+	}
+
+	doRequest(t, s, http.MethodGet, "/decode?name=user&id=%21%21", "", http.StatusBadRequest, nil)
+	doRequest(t, s, http.MethodGet, "/decode?name=missing&id="+iv.Encoded, "", http.StatusNotFound, nil)
+}
+
+func TestServer_lease(t *testing.T) {
+	s := newTestServer(t)
+	doRequest(t, s, http.MethodPost, "/set", `{"name": "user", "value": 100}`, http.StatusOK, nil)
+
+	lease := &mysqlid.RangeLease{}
+	doRequest(t, s, http.MethodPost, "/lease", `{"name": "user", "count": 10, "client": "importer"}`, http.StatusOK, lease)
+	if lease.Size() != 10 || lease.Start <= 100 || lease.Client != "importer" {
+		t.Fatalf("invalid lease: %+v", lease)
+	}
+
+	body := `{"id": ` + strconv.FormatInt(lease.Id, 10) + `, "used": 6}`
+	doRequest(t, s, http.MethodPost, "/lease/report", body, http.StatusOK, nil)
+	doRequest(t, s, http.MethodPost, "/lease/report", `{"id": 9999, "used": 1}`, http.StatusNotFound, nil)
+
+	var leases []*mysqlid.RangeLease
+	doRequest(t, s, http.MethodGet, "/leases?name=user", "", http.StatusOK, &leases)
+	if len(leases) != 1 || leases[0].Used != 6 {
+		t.Fatalf("the reported lease should be listed, got %+v", leases)
+	}
+
+	doRequest(t, s, http.MethodGet, "/lease", "", http.StatusMethodNotAllowed, nil)
+	doRequest(t, s, http.MethodPost, "/lease", `{"name": "user", "count": 0}`, http.StatusBadRequest, nil)
+	doRequest(t, s, http.MethodPost, "/lease", `{"name": "missing", "count": 10}`, http.StatusNotFound, nil)
+}
+
+func TestServer_ledger(t *testing.T) {
+	c := mysqlid.NewConfig()
+	c.Ledger = true
+	mysqlid.SetConfig(c)
+	defer mysqlid.SetConfig(mysqlid.NewConfig())
+
+	s := newTestServer(t)
+	doRequest(t, s, http.MethodPost, "/set", `{"name": "user", "value": 100}`, http.StatusOK, nil)
+	doRequest(t, s, http.MethodGet, "/next?name=user", "", http.StatusOK, nil)
+
+	var entries []*mysqlid.LedgerEntry
+	doRequest(t, s, http.MethodGet, "/ledger?name=user&id=101", "", http.StatusOK, &entries)
+	if len(entries) != 1 || entries[0].Reason != mysqlid.LedgerAlloc || entries[0].Start != 101 {
+		t.Fatalf("the allocated segment should be recorded, got %+v", entries)
+	}
+
+	doRequest(t, s, http.MethodGet, "/ledger?limit=1", "", http.StatusOK, &entries)
+	if len(entries) != 1 {
+		t.Fatalf("the entries should be limited to 1, got %d", len(entries))
+	}
+
+	doRequest(t, s, http.MethodGet, "/ledger?id=x", "", http.StatusBadRequest, nil)
+	doRequest(t, s, http.MethodGet, "/ledger?limit=0", "", http.StatusBadRequest, nil)
+}
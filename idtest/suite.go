@@ -0,0 +1,432 @@
+// Package idtest provides the conformance test suite for the id generators and the id storages.
+//
+// Every generator and storage backend should be verified by it. eg:
+//
+//	func TestStorage(t *testing.T) {
+//		idtest.RunStorage(t, func(t *testing.T) mysqlid.Storage {
+//			return NewStorage(...)
+//		})
+//	}
+package idtest
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/inherelab/genid"
+	"github.com/inherelab/genid/mysqlid"
+)
+
+const (
+	// the goroutines and the ids of each goroutine on concurrency test
+	workers   = 8
+	workerIds = 500
+	// small batch count, for rollover the segment frequently
+	smallBatch = 10
+)
+
+// GeneratorFactory create a new generator for the service name
+type GeneratorFactory func(t *testing.T, name string) genid.GeneratorFace
+
+// StorageFactory open the storage.
+// calling it again should open the storage on same data, for check the persistence across restart.
+type StorageFactory func(t *testing.T) mysqlid.Storage
+
+// RunGenerator run the conformance tests for the generator:
+// the ids should be monotonic increasing, and unique under concurrency.
+// if the generator implements mysqlid.BulkGenerator, check the bulk fetch too.
+func RunGenerator(t *testing.T, newGen GeneratorFactory) {
+	t.Run("Monotonic", func(t *testing.T) {
+		gen := newGen(t, "idtest_monotonic")
+
+		var last int64
+		for i := 0; i < workerIds*2; i++ {
+			id := mustNext(t, gen)
+			if id <= last {
+				t.Fatalf("the id %d is not greater than the last id %d", id, last)
+			}
+			if cur := gen.Current(); cur != id {
+				t.Fatalf("the current id %d is not equals the last next id %d", cur, id)
+			}
+			last = id
+		}
+	})
+
+	t.Run("ConcurrentUnique", func(t *testing.T) {
+		checkUnique(t, newGen(t, "idtest_concurrent"))
+	})
+
+	t.Run("Bulk", func(t *testing.T) {
+		gen := newGen(t, "idtest_bulk")
+		bg, ok := gen.(mysqlid.BulkGenerator)
+		if !ok {
+			t.Skipf("the generator %T not support bulk fetch", gen)
+		}
+
+		last := mustNext(t, gen)
+		ids, err := bg.NextN(workerIds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) != workerIds {
+			t.Fatalf("should returns %d ids, but got %d", workerIds, len(ids))
+		}
+
+		for _, id := range ids {
+			if id <= last {
+				t.Fatalf("the id %d is not greater than the last id %d", id, last)
+			}
+			last = id
+		}
+
+		if id := mustNext(t, gen); id <= last {
+			t.Fatalf("the id %d after bulk fetch is not greater than the last id %d", id, last)
+		}
+	})
+}
+
+// RunStorage run the conformance tests for the storage, and the mysqlid.Generator on it.
+func RunStorage(t *testing.T, open StorageFactory) {
+	t.Run("Reset", func(t *testing.T) {
+		store := initStorage(t, open)
+		key := "idtest_reset"
+
+		mustReset(t, store, key, 100, false, 100)
+		// exists and force=false, dont change the id.
+		mustReset(t, store, key, 500, false, 100)
+		mustReset(t, store, key, 500, true, 500)
+
+		ok, err := store.Exists(key)
+		if err != nil || !ok {
+			t.Fatalf("the key should exists, err: %v", err)
+		}
+	})
+
+	t.Run("Alloc", func(t *testing.T) {
+		store := initStorage(t, open)
+		key := "idtest_alloc"
+		mustReset(t, store, key, 0, true, 0)
+
+		for i := int64(0); i < 3; i++ {
+			start, err := store.Alloc(key, smallBatch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if start != i*smallBatch {
+				t.Fatalf("the range start should be %d, but got %d", i*smallBatch, start)
+			}
+		}
+
+		mustCurrent(t, store, key, 3*smallBatch)
+	})
+
+	t.Run("Wrap", func(t *testing.T) {
+		store := initStorage(t, open)
+		w, ok := store.(mysqlid.Wrapper)
+		if !ok {
+			t.Skip("the storage is not a mysqlid.Wrapper")
+		}
+
+		key := "idtest_wrap"
+		mustReset(t, store, key, 100, true, 100)
+		if id, wrapped, err := w.Wrap(key, 101, 0); err != nil || wrapped || id != 100 {
+			t.Fatalf("should not wrap under the threshold, got id=%d wrapped=%v err=%v", id, wrapped, err)
+		}
+
+		// only one of the concurrent callers wraps the id
+		var wg sync.WaitGroup
+		var lock sync.Mutex
+		wraps := 0
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, wrapped, err := w.Wrap(key, 100, 0)
+				if err != nil {
+					t.Error(err)
+				}
+				if wrapped {
+					lock.Lock()
+					wraps++
+					lock.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		if wraps != 1 {
+			t.Fatalf("the id should be wrapped once, but wrapped %d times", wraps)
+		}
+		mustCurrent(t, store, key, 0)
+	})
+
+	t.Run("OptionsAndDelete", func(t *testing.T) {
+		store := initStorage(t, open)
+		key := "idtest_delete"
+		mustReset(t, store, key, 1, true, 1)
+
+		if err := store.SaveOptions(key, &mysqlid.Options{Batch: smallBatch}); err != nil {
+			t.Fatal(err)
+		}
+		opts, err := store.Options(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opts.Batch != smallBatch {
+			t.Fatalf("the batch option should be %d, but got %d", smallBatch, opts.Batch)
+		}
+
+		if !hasKey(t, store, key) {
+			t.Fatalf("the key %s should be listed", key)
+		}
+		if err = store.Delete(key); err != nil {
+			t.Fatal(err)
+		}
+		if hasKey(t, store, key) {
+			t.Fatalf("the key %s should be deleted", key)
+		}
+	})
+
+	t.Run("Lease", func(t *testing.T) {
+		store := initStorage(t, open)
+		if _, ok := store.(mysqlid.RangeLeaser); !ok {
+			t.Skip("the storage is not a mysqlid.RangeLeaser")
+		}
+
+		key := "idtest_lease"
+		lease := &mysqlid.RangeLease{Key: key, Client: "idtest", Start: 11, End: 20, Step: 1, CreatedAt: time.Now()}
+		if err := store.(mysqlid.RangeLeaser).SaveLease(lease); err != nil {
+			t.Fatal(err)
+		}
+		if lease.Id < 1 {
+			t.Fatalf("the lease id should be set, but got %d", lease.Id)
+		}
+
+		if err := store.(mysqlid.RangeLeaser).ReportLease(lease.Id, 6); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.(mysqlid.RangeLeaser).ReportLease(lease.Id+1<<40, 1); err != mysqlid.ErrLeaseNotExists {
+			t.Fatalf("should returns ErrLeaseNotExists, but got %v", err)
+		}
+
+		// the leases are persisted
+		closeStorage(t, store)
+		store = initStorage(t, open)
+		leases, err := store.(mysqlid.RangeLeaser).Leases(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(leases) == 0 {
+			t.Fatal("the saved lease should be listed")
+		}
+
+		l := leases[len(leases)-1]
+		if l.Id != lease.Id || l.Client != "idtest" || l.Start != 11 || l.End != 20 || l.Used != 6 || l.ReportedAt.IsZero() {
+			t.Fatalf("invalid lease %+v", l)
+		}
+	})
+
+	for _, double := range []bool{false, true} {
+		double := double
+		newGen := func(t *testing.T, name string) genid.GeneratorFace {
+			return newGenerator(t, initStorage(t, open), name, double)
+		}
+
+		t.Run(fmt.Sprintf("Generator/DoubleBuffer=%v", double), func(t *testing.T) {
+			RunGenerator(t, newGen)
+			t.Run("Rollover", func(t *testing.T) {
+				checkRollover(t, newGen(t, "idtest_rollover"))
+			})
+		})
+	}
+
+	// the generators of the nodes on the same storage should not generate the same ids
+	t.Run("MultiNodeUnique", func(t *testing.T) {
+		store := initStorage(t, open)
+		name := "idtest_multi_node"
+		checkUnique(t, newGenerator(t, store, name, true), newGenerator(t, store, name, false))
+	})
+
+	t.Run("GeneratorReset", func(t *testing.T) {
+		gen := newGenerator(t, initStorage(t, open), "idtest_gen_reset", true)
+		mustNext(t, gen)
+
+		if err := gen.Reset(1000, true); err != nil {
+			t.Fatal(err)
+		}
+		if id := mustNext(t, gen); id != 1001 {
+			t.Fatalf("the next id after reset should be 1001, but got %d", id)
+		}
+
+		// force=false, should not go back
+		if err := gen.Reset(1, false); err != nil {
+			t.Fatal(err)
+		}
+		if id := mustNext(t, gen); id <= 1001 {
+			t.Fatalf("the next id %d should be greater than 1001", id)
+		}
+	})
+
+	t.Run("Restart", func(t *testing.T) {
+		name := "idtest_restart"
+		store := initStorage(t, open)
+		gen := newGenerator(t, store, name, true)
+
+		var last int64
+		for i := 0; i < smallBatch+3; i++ {
+			last = mustNext(t, gen)
+		}
+		closeStorage(t, store)
+
+		// the restarted generator should not reuse the ids
+		gen = newGenerator(t, initStorage(t, open), name, true)
+		if err := gen.Reset(0, false); err != nil {
+			t.Fatal(err)
+		}
+		if id := mustNext(t, gen); id <= last {
+			t.Fatalf("the id %d after restart is not greater than the last id %d", id, last)
+		}
+	})
+}
+
+func initStorage(t *testing.T, open StorageFactory) mysqlid.Storage {
+	store := open(t)
+	if err := store.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func closeStorage(t *testing.T, store mysqlid.Storage) {
+	if c, ok := store.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// create generator with small batch count. the existing key will not be reset.
+func newGenerator(t *testing.T, store mysqlid.Storage, name string, double bool) *mysqlid.Generator {
+	if _, err := store.Reset(name, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveOptions(name, &mysqlid.Options{Batch: smallBatch}); err != nil {
+		t.Fatal(err)
+	}
+
+	gen, err := mysqlid.NewGenerator(store, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gen.SetDoubleBuffer(double)
+	if err = gen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	return gen
+}
+
+// the ids of the segments should be continuous
+func checkRollover(t *testing.T, gen genid.GeneratorFace) {
+	first := mustNext(t, gen)
+	for i := int64(1); i <= smallBatch*3; i++ {
+		if id := mustNext(t, gen); id != first+i {
+			t.Fatalf("the id should be %d on rollover, but got %d", first+i, id)
+		}
+	}
+}
+
+// generate ids concurrently on the generators, the ids should be unique.
+// the workers are assigned to the generators in turn.
+func checkUnique(t *testing.T, gens ...genid.GeneratorFace) {
+	var wg sync.WaitGroup
+	results := make([][]int64, workers)
+	errs := make(chan error, workers)
+
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func(i int) {
+			defer wg.Done()
+
+			gen := gens[i%len(gens)]
+			ids := make([]int64, 0, workerIds)
+			for j := 0; j < workerIds; j++ {
+				id, err := gen.Next()
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				// the ids of each goroutine should be increasing
+				if n := len(ids); n > 0 && id <= ids[n-1] {
+					errs <- fmt.Errorf("the id %d is not greater than the last id %d", id, ids[n-1])
+					return
+				}
+				ids = append(ids, id)
+			}
+			results[i] = ids
+		}(i)
+	}
+	wg.Wait()
+
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	seen := make(map[int64]bool, workers*workerIds)
+	for _, ids := range results {
+		for _, id := range ids {
+			if seen[id] {
+				t.Fatalf("the id %d is duplicated", id)
+			}
+			seen[id] = true
+		}
+	}
+}
+
+func mustNext(t *testing.T, gen genid.GeneratorFace) int64 {
+	id, err := gen.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func mustReset(t *testing.T, store mysqlid.Storage, key string, id int64, force bool, want int64) {
+	got, err := store.Reset(key, id, force)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatalf("Reset(%s, %d, %v) should returns %d, but got %d", key, id, force, want, got)
+	}
+	mustCurrent(t, store, key, want)
+}
+
+func mustCurrent(t *testing.T, store mysqlid.Storage, key string, want int64) {
+	cur, err := store.Current(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur != want {
+		t.Fatalf("the current id of %s should be %d, but got %d", key, want, cur)
+	}
+}
+
+func hasKey(t *testing.T, store mysqlid.Storage, key string) bool {
+	keys, err := store.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package mysqlid
+
+import "time"
+
+const (
+	// MinBatchCount the default min batch count on adaptive batch enabled
+	MinBatchCount = 1000
+	// MaxBatchCount the default max batch count on adaptive batch enabled
+	MaxBatchCount = 1000000
+	// BatchPeriod the default expected seconds of fetch segment once on adaptive batch enabled
+	BatchPeriod = 900
+)
+
+// adjustBatch adjust the batch count by the duration of the last segment used. like the Meituan Leaf:
+//   - elapsed < period:   batch * 2, not greater than max
+//   - elapsed < period*2: keep the batch
+//   - else:               batch / 2, not less than min
+func adjustBatch(batch int64, elapsed, period time.Duration, min, max int64) int64 {
+	switch {
+	case elapsed < period:
+		batch = batch * 2
+	case elapsed < period*2:
+		// keep
+	default:
+		batch = batch / 2
+	}
+
+	if batch > max {
+		batch = max
+	}
+	if batch < min {
+		batch = min
+	}
+	return batch
+}
+
+// batchRange get the adaptive batch settings of the service.
+// returns enable=false on the adaptive batch is disabled.
+// the explicit batch of the service is fixed, unless the service has the min_batch or max_batch.
+func batchRange(opts *Options) (min, max int64, period time.Duration, enable bool) {
+	if !cfg.AdaptiveBatch && opts.MaxBatch == 0 {
+		return
+	}
+	if opts.Batch > 0 && opts.MinBatch == 0 && opts.MaxBatch == 0 {
+		return
+	}
+
+	min, max = cfg.MinBatch, cfg.MaxBatch
+	if opts.MinBatch > 0 {
+		min = opts.MinBatch
+	}
+	if opts.MaxBatch > 0 {
+		max = opts.MaxBatch
+	}
+
+	secs := cfg.BatchPeriod
+	if opts.Period > 0 {
+		secs = opts.Period
+	}
+
+	if min <= 0 || max < min || secs <= 0 {
+		return
+	}
+	return min, max, time.Duration(secs) * time.Second, true
+}
@@ -0,0 +1,35 @@
+package mysqlid
+
+import "time"
+
+// TestMySQLEnv the env var of the MySQL dsn for the tests. eg: "root:@tcp(127.0.0.1:3306)/test"
+// the MySQL tests are skipped if it's not set.
+const TestMySQLEnv = "GENID_TEST_MYSQL_DSN"
+
+// SetScopedClock replace the clock of the scoped service, for tests
+func SetScopedClock(s *ScopedService, now func() time.Time) {
+	s.mu.Lock()
+	s.now = now
+	s.mu.Unlock()
+}
+
+// WaitPreload wait the background preload of the generator finished, for tests
+func WaitPreload(g *Generator) {
+	g.lock.Lock()
+	g.waitLoading()
+	g.lock.Unlock()
+}
+
+// ExpireWorker expire the worker id lease on the memory storage, for tests
+func ExpireWorker(s *MemoryStorage, workerId int64) {
+	s.lock.Lock()
+	if w, ok := s.workers[workerId]; ok {
+		w.expireAt = time.Now().Add(-time.Second)
+	}
+	s.lock.Unlock()
+}
+
+// RenewLease renew the leased worker id of the manager once, like the heartbeat. for tests
+func RenewLease(m *Manager) error {
+	return m.lease.renew()
+}
@@ -0,0 +1,170 @@
+package mysqlid
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the parts kind of the format template
+const (
+	partText = iota
+	partSeq
+	partDate
+	partLuhn
+)
+
+// the date pattern tokens to the go time layout, the longer tokens first
+var datePatterns = strings.NewReplacer(
+	"yyyy", "2006",
+	"yy", "06",
+	"MM", "01",
+	"dd", "02",
+	"HH", "15",
+	"mm", "04",
+	"ss", "05",
+)
+
+// Template the format template of the ids. the placeholders:
+//
+//	{seq}              the id
+//	{seq:08}           the zero padded id, the width is 8
+//	{date:yyyyMMdd}    the date of generated, tokens: yyyy, yy, MM, dd, HH, mm, ss
+//	{luhn}             the Luhn check digit of all digits before it
+//
+// eg: "INV-{date:yyyyMMdd}-{seq:08}{luhn}" formats the id 123 as "INV-20261018-000001234"
+type Template struct {
+	raw   string
+	parts []tplPart
+}
+
+type tplPart struct {
+	kind  int
+	text  string // the text or the date layout
+	width int    // the zero padded width of seq
+}
+
+// ParseTemplate parse the format template
+func ParseTemplate(s string) (*Template, error) {
+	t := &Template{raw: s}
+	hasSeq := false
+
+	for len(s) > 0 {
+		pos := strings.IndexByte(s, '{')
+		if pos < 0 {
+			t.parts = append(t.parts, tplPart{kind: partText, text: s})
+			break
+		}
+		if pos > 0 {
+			t.parts = append(t.parts, tplPart{kind: partText, text: s[:pos]})
+		}
+
+		end := strings.IndexByte(s[pos:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("format template: unclosed placeholder at %d", len(t.raw)-len(s)+pos)
+		}
+
+		name, arg := s[pos+1:pos+end], ""
+		if i := strings.IndexByte(name, ':'); i >= 0 {
+			name, arg = name[:i], name[i+1:]
+		}
+
+		part, err := parsePart(name, arg)
+		if err != nil {
+			return nil, err
+		}
+		if part.kind == partSeq {
+			hasSeq = true
+		}
+
+		t.parts = append(t.parts, part)
+		s = s[pos+end+1:]
+	}
+
+	if !hasSeq {
+		return nil, fmt.Errorf("format template: the {seq} is required")
+	}
+	return t, nil
+}
+
+func parsePart(name, arg string) (tplPart, error) {
+	switch name {
+	case "seq":
+		if arg == "" {
+			return tplPart{kind: partSeq}, nil
+		}
+		width, err := strconv.Atoi(arg)
+		if err != nil || width < 1 || width > 19 {
+			return tplPart{}, fmt.Errorf("format template: invalid width of the seq: %s", arg)
+		}
+		return tplPart{kind: partSeq, width: width}, nil
+	case "date":
+		if arg == "" {
+			return tplPart{}, fmt.Errorf("format template: the pattern of date is required")
+		}
+		return tplPart{kind: partDate, text: datePatterns.Replace(arg)}, nil
+	case "luhn":
+		return tplPart{kind: partLuhn}, nil
+	}
+	return tplPart{}, fmt.Errorf("format template: unknown placeholder {%s}", name)
+}
+
+// String get the raw template
+func (t *Template) String() string {
+	return t.raw
+}
+
+// Format the id by the template, the date placeholders use the time at.
+func (t *Template) Format(id int64, at time.Time) string {
+	buf := make([]byte, 0, 32)
+	for _, part := range t.parts {
+		switch part.kind {
+		case partText:
+			buf = append(buf, part.text...)
+		case partSeq:
+			seq := strconv.FormatInt(id, 10)
+			for i := len(seq); i < part.width; i++ {
+				buf = append(buf, '0')
+			}
+			buf = append(buf, seq...)
+		case partDate:
+			buf = at.AppendFormat(buf, part.text)
+		case partLuhn:
+			buf = append(buf, luhnDigit(buf))
+		}
+	}
+	return string(buf)
+}
+
+// ValidLuhn check the last digit of s is the Luhn check digit of the digits before it.
+// the non-digit characters are ignored. eg: ValidLuhn("INV-20261018-000001234") is true
+func ValidLuhn(s string) bool {
+	last := strings.LastIndexAny(s, "0123456789")
+	if last < 0 {
+		return false
+	}
+	return luhnDigit([]byte(s[:last])) == s[last]
+}
+
+// compute the Luhn check digit of the digits in bs, the non-digit bytes are ignored.
+func luhnDigit(bs []byte) byte {
+	sum, double := 0, true
+	for i := len(bs) - 1; i >= 0; i-- {
+		c := bs[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return byte('0' + (10-sum%10)%10)
+}
@@ -0,0 +1,76 @@
+package mysqlid_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inherelab/genid/mysqlid"
+)
+
+func TestTemplate(t *testing.T) {
+	tpl, err := mysqlid.ParseTemplate("INV-{date:yyyyMMdd}-{seq:08}{luhn}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)
+	str := tpl.Format(123, at)
+	if !strings.HasPrefix(str, "INV-20261018-00000123") || len(str) != 22 {
+		t.Fatalf("invalid formatted id %s", str)
+	}
+	if !mysqlid.ValidLuhn(str) {
+		t.Fatalf("the check digit of %s is invalid", str)
+	}
+	if mysqlid.ValidLuhn("INV-20261018-00000124" + str[21:]) {
+		t.Fatal("the check digit should be invalid on the changed id")
+	}
+
+	tpl, _ = mysqlid.ParseTemplate("T{date:yyMMddHHmmss}{seq}")
+	if str = tpl.Format(7, at); str != "T2610180930007" {
+		t.Fatalf("invalid formatted id %s", str)
+	}
+
+	for _, s := range []string{"INV-{date:yyyy}", "{seq:0}", "{seq", "{uuid}{seq}", "{date}{seq}"} {
+		if _, err = mysqlid.ParseTemplate(s); err == nil {
+			t.Fatalf("should returns error on the template %s", s)
+		}
+	}
+}
+
+func TestManager_format(t *testing.T) {
+	mgr := mysqlid.NewManager(mysqlid.NewMemoryStorage())
+	if err := mgr.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	name := "invoice"
+	if _, err := mgr.SetServiceId(name, 100, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// opt-in per request
+	id, str, err := mgr.NextFormatted(name, "T-{seq:05}")
+	if err != nil || id != 101 || str != "T-00101" {
+		t.Fatalf("invalid formatted id %d %s, err: %v", id, str, err)
+	}
+	if str, _ = mgr.NextString(name); str != "102" {
+		t.Fatalf("the id should not be formatted without the service format, got %s", str)
+	}
+
+	// opt-in per service
+	err = mgr.SetServiceOptions(name, map[string]string{"format": "INV{seq:06}{luhn}", "tz": "UTC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if str, _ = mgr.NextString(name); !strings.HasPrefix(str, "INV000103") || !mysqlid.ValidLuhn(str) {
+		t.Fatalf("invalid formatted id %s", str)
+	}
+	if id, _ = mgr.NextId(name); id != 104 {
+		t.Fatalf("the raw id should be 104, but got %d", id)
+	}
+
+	if err = mgr.SetServiceOptions(name, map[string]string{"format": "{unknown}"}); err == nil {
+		t.Fatal("should returns error on invalid format")
+	}
+}
@@ -1,46 +1,45 @@
 package mysqlid
 
 import (
+	"database/sql"
 	"fmt"
+	"os"
 	"sync"
 	"testing"
 
 	_ "github.com/go-sql-driver/mysql"
-	"github.com/gookit/config/v2"
-	"github.com/gookit/config/v2/toml"
-	"github.com/gookit/config/v2/yaml"
 )
 
 var wg sync.WaitGroup
 
-func init() {
-	var err error
-
-	config.AddDriver(toml.Driver)
-	config.AddDriver(yaml.Driver)
+var (
+	setupOnce sync.Once
+	setupErr  error
+)
 
-	// load config
-	err = config.LoadFiles("../config/config.toml")
-	if err != nil {
-		panic(err)
+// init the std manager on the MySQL of the dsn TestMySQLEnv.
+// skip the test if the env is not set.
+func setupMySQL(tb testing.TB) {
+	dsn := os.Getenv(TestMySQLEnv)
+	if dsn == "" {
+		tb.Skip("skip the MySQL test: the env " + TestMySQLEnv + " is not set")
 	}
 
-	// init mysqlId generator
-	dbCfg := &DBConfig{}
-	err = config.MapStruct("db", dbCfg)
-	if err != nil {
-		panic(err)
-	}
-	// dump.Println(dbCfg)
+	setupOnce.Do(func() {
+		db, err := sql.Open("mysql", dsn)
+		if err == nil {
+			err = db.Ping()
+		}
+		if err != nil {
+			setupErr = err
+			return
+		}
 
-	db, err := InitSqlDB(dbCfg)
-	if err != nil {
-		panic(err)
-	}
+		setupErr = InitStdManager(NewMySQLStorage(db))
+	})
 
-	err = InitStdManager(db)
-	if err != nil {
-		panic(err)
+	if setupErr != nil {
+		tb.Skip("skip the MySQL test:", setupErr)
 	}
 }
 
@@ -56,7 +55,8 @@ func forGetId(idGenerator *Generator) {
 }
 
 func TestMySQLId1Gen(t *testing.T) {
-	idGenerator, err := NewGenerator(Db, "idgen_test")
+	setupMySQL(t)
+	idGenerator, err := NewGenerator(Std().Storage(), "idgen_test")
 	if err != nil {
 		t.Fatal(err.Error())
 	}
@@ -80,7 +80,8 @@ func TestMySQLId1Gen(t *testing.T) {
 }
 
 func BenchmarkMySQLIdGen(b *testing.B) {
-	idGenerator, err := NewGenerator(Db, "idgen_bench")
+	setupMySQL(b)
+	idGenerator, err := NewGenerator(Std().Storage(), "idgen_bench")
 	if err != nil {
 		b.Fatal(err.Error())
 	}
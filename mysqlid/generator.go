@@ -1,45 +1,45 @@
 package mysqlid
 
 import (
-	"database/sql"
+	"errors"
 	"fmt"
+	"math"
 	"sync"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
 	"github.com/gookit/slog"
 )
 
 const (
-	// create name table
-	CreateTableSQLFormat = `
-CREATE TABLE %s (
-    id bigint(20) unsigned NOT NULL auto_increment,
-    PRIMARY KEY  (id)
-) ENGINE=Innodb DEFAULT CHARSET=utf8`
-
-	// create name table if not exist
-	CreateTableNTSQLFormat = `
-CREATE TABLE IF NOT EXISTS %s (
-    id bigint(20) unsigned NOT NULL auto_increment,
-    PRIMARY KEY  (id)
-) ENGINE=Innodb DEFAULT CHARSET=utf8`
-
-	DropTableSQLFormat   = `DROP TABLE IF EXISTS %s`
-	InsertIdSQLFormat    = "INSERT INTO %s(`id`) VALUES(%d)"
-	SelectForUpdate      = "SELECT `id` FROM %s FOR UPDATE"
-	UpdateIdSQLFormat    = "UPDATE `%s` SET `id` = `id` + %d"
-	GetRowCountSQLFormat = "SELECT count(*) FROM `%s`"
-	// SHOW TABLES LIKE '%service_user%';
-	// SHOW TABLES WHERE Tables_in_{DB_NAME} = 'service_user';
-	GetKeySQLFormat = "SHOW TABLES LIKE '%s'"
-
 	// 获取id的自增步长
 	BatchCount = 2000
+	// PreloadRatio when the used ratio of current segment reached it, will preload next segment.
+	PreloadRatio = 0.1
+	// BlockInterval the interval of reload the service options, on the id reached the max_id and blocked.
+	BlockInterval = time.Second
 )
 
+// ErrIdExhausted the id reached the max_id of the service
+var ErrIdExhausted = errors.New("the id is exhausted, reached the max_id")
+
+// OnExhaustAlert called on the id reached the alert threshold of the max_id. default is log a warning.
+var OnExhaustAlert = func(name string, id, maxId int64, threshold float64) {
+	slog.Warnf("%s: the id %d reached %.0f%% of the max_id %d", name, id, threshold*100, maxId)
+}
+
+// segment an id range (start, max] fetched from db
+type segment struct {
+	start int64
+	max   int64
+	// the service options on fetched
+	opts *Options
+	// the time of fetched from db
+	fetchedAt time.Time
+}
+
 // Generator struct
 type Generator struct {
-	db *sql.DB
+	store Storage
 
 	// the service name. id generator name name.
 	name string
@@ -48,15 +48,36 @@ type Generator struct {
 	current  int64 // current id
 	batchMax int64 // max id till get from mysql
 	batch    int64 // get batch count ids from mysql once
+	segStart int64 // start id of the current segment
+	// the fetched time of the current segment, for adjust batch count
+	fetchedAt time.Time
+
+	// service options, load from manager table
+	opts *Options
+
+	// double buffer: preload next segment on background
+	doubleBuffer bool
+	preloadRatio float64
+	next         *segment   // the preloaded next segment
+	loading      bool       // mark the next segment is loading
+	loaded       *sync.Cond // notify on loading finished
+	// the preload of the current segment failed, don't retry until the next segment is used
+	preloadFailed bool
+
+	// the alert state of the max_id
+	alertMax int64 // the max_id of the alert state
+	alertIdx int   // the index of the next alert threshold
+	alertAt  int64 // the id of the next alert
 }
 
-func NewGenerator(db *sql.DB, serviceName string) (*Generator, error) {
+// NewGenerator create generator for the service
+func NewGenerator(store Storage, serviceName string) (*Generator, error) {
 	if len(serviceName) == 0 {
 		return nil, fmt.Errorf("service name is nil")
 	}
 
 	generator := new(Generator)
-	generator.db = db
+	generator.store = store
 
 	// err := generator.SetSection(serviceName)
 	// if err != nil {
@@ -64,12 +85,23 @@ func NewGenerator(db *sql.DB, serviceName string) (*Generator, error) {
 	// }
 
 	generator.name = serviceName
+	generator.loaded = sync.NewCond(&generator.lock)
 
 	generator.current = 0
 	generator.batch = BatchCount
+	if cfg.BatchCount > 0 {
+		generator.batch = cfg.BatchCount
+	}
+	generator.opts = &Options{}
 	// generator.batchMax = BatchCount
 	generator.batchMax = 0
 
+	generator.doubleBuffer = cfg.DoubleBuffer
+	generator.preloadRatio = cfg.PreloadRatio
+	if generator.preloadRatio <= 0 || generator.preloadRatio >= 1 {
+		generator.preloadRatio = PreloadRatio
+	}
+
 	return generator, nil
 }
 
@@ -80,11 +112,17 @@ func (m *Generator) Init() error {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	m.current, err = m.getLastIdFromDb()
+	m.waitLoading()
+	m.current, err = m.store.Current(m.name)
 	if err != nil {
 		return err
 	}
-	m.batchMax = m.current
+
+	opts, err := m.store.Options(m.name)
+	if err != nil {
+		return err
+	}
+	m.useSegment(&segment{start: m.current, max: m.current, opts: opts})
 
 	return nil
 }
@@ -94,37 +132,32 @@ func (m *Generator) Init() error {
 // 	return nil
 // }
 
-// get last id from db table
-func (m *Generator) getLastIdFromDb() (int64, error) {
-	selectForUpdate := fmt.Sprintf(SelectForUpdate, m.name)
-	tx, err := m.db.Begin()
-	if err != nil {
-		return 0, err
-	}
+// Name get service name
+func (m *Generator) Name() string {
+	return m.name
+}
 
-	slog.Infof("SQL=%s", selectForUpdate)
-	rows, err := tx.Query(selectForUpdate)
-	if err != nil {
-		tx.Rollback()
-		return 0, err
-	}
+// Batch get the batch count for fetch ids from db once
+func (m *Generator) Batch() int64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
 
-	var id int64
-	defer rows.Close()
+	return m.opts.BatchOr(m.batch)
+}
 
-	// read one line
-	for rows.Next() {
-		err := rows.Scan(&id)
-		if err != nil {
-			tx.Rollback()
-			return 0, err
-		}
-	}
+// Options get a copy of the service options
+func (m *Generator) Options() Options {
+	m.lock.Lock()
+	defer m.lock.Unlock()
 
-	tx.Commit()
+	return *m.opts
+}
 
-	slog.Infof("get last id form db table: %s, last: %d", m.name, id)
-	return id, nil
+// SetOptions set service options. will be used on fetch next segment
+func (m *Generator) SetOptions(opts *Options) {
+	m.lock.Lock()
+	m.opts = opts
+	m.lock.Unlock()
 }
 
 // Current get current id
@@ -135,149 +168,355 @@ func (m *Generator) Current() int64 {
 	return m.current
 }
 
+// SetDoubleBuffer enable or disable preload next segment on background
+func (m *Generator) SetDoubleBuffer(enable bool) {
+	m.lock.Lock()
+	m.doubleBuffer = enable
+	m.lock.Unlock()
+}
+
 // Next get next id
 func (m *Generator) Next() (int64, error) {
-	var id int64
-	var haveValue bool
+	m.lock.Lock()
+	defer m.lock.Unlock()
 
-	selectForUpdate := fmt.Sprintf(SelectForUpdate, m.name)
-	updateIdSql := fmt.Sprintf(UpdateIdSQLFormat, m.name, m.batch)
+	return m.nextId()
+}
 
+// NextN get n ids in one locked operation.
+// the ids are increasing, and contiguous in one segment, maybe non-contiguous on cross segments.
+func (m *Generator) NextN(n int) ([]int64, error) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	if m.batchMax < m.current+1 {
-		tx, err := m.db.Begin()
+	ids := make([]int64, n)
+	for i := range ids {
+		id, err := m.nextId()
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
+		ids[i] = id
+	}
 
-		slog.Infof("max=%d cur=%d SQL=%s", m.batchMax, m.current, selectForUpdate)
-		rows, err := tx.Query(selectForUpdate)
-		if err != nil {
-			tx.Rollback()
-			return 0, err
-		}
+	return ids, nil
+}
+
+// Reserve n contiguous ids on the step, returns the first and the last id.
+// the ids are taken from the current segment if it has enough ids, otherwise allocated from the storage directly
+// and the current segment is kept. if the ids exceed the max_id, it's handled by the exhausted policy like Next.
+func (m *Generator) Reserve(n int64) (first, last int64, err error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
 
-		defer rows.Close()
-		for rows.Next() {
-			err := rows.Scan(&id)
+	for {
+		first = m.opts.Align(m.current + 1)
+		last = first + (n-1)*m.opts.StepOr()
+		if last > m.batchMax {
+			// the max_id is checked before allocating
+			first, last, err = m.allocRange(n)
 			if err != nil {
-				tx.Rollback()
-				return 0, err
+				return 0, 0, err
 			}
-			haveValue = true
-		}
-
-		// When the table has no id name
-		if haveValue == false {
-			return 0, fmt.Errorf("%s: have no id name", m.name)
+			appendLedger(m.store, m.name, LedgerAlloc, first, last)
+			return first, last, nil
 		}
 
-		slog.Infof("dbId=%d SQL=%s", id, updateIdSql)
-		_, err = tx.Exec(updateIdSql)
-		if err != nil {
-			tx.Rollback()
-			return 0, err
+		if m.opts.MaxId > 0 && last > m.opts.MaxId {
+			if err := m.exhausted(n); err != nil {
+				return 0, 0, err
+			}
+			continue
 		}
 
-		tx.Commit()
-
-		// batchMax is larger than current BatchCount
-		m.batchMax = id + BatchCount
-		m.current = id
+		m.current = last
+		m.checkAlert()
+		m.checkPreload()
+		return first, last, nil
 	}
-
-	m.current++
-	return m.current, nil
 }
 
-// if force is true, create table directly
-// if force is false, create table use CreateTableNTSQLFormat
-func (m *Generator) Reset(idOffset int64, force bool) error {
-	var err error
-	createTableSQL := fmt.Sprintf(CreateTableSQLFormat, m.name)
-	createTableNtSQL := fmt.Sprintf(CreateTableNTSQLFormat, m.name)
-	dropTableSQL := fmt.Sprintf(DropTableSQLFormat, m.name)
-
+// AllocRange allocate n contiguous ids on the step from the storage directly, returns the first and the last id.
+// the current segment is kept. the max_id is checked before allocating, and handled by the exhausted policy.
+func (m *Generator) AllocRange(n int64) (first, last int64, err error) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	// drop table an create table
-	if force == true {
-		slog.Infof("SQL=%s", dropTableSQL)
-		_, err = m.db.Exec(dropTableSQL)
-		if err != nil {
-			return err
+	return m.allocRange(n)
+}
+
+// allocate n ids from the storage directly. must be called on locked.
+func (m *Generator) allocRange(n int64) (first, last int64, err error) {
+	for {
+		step := m.opts.StepOr()
+		if m.opts.MaxId > 0 {
+			id, err := m.store.Current(m.name)
+			if err != nil {
+				return 0, 0, err
+			}
+
+			if m.opts.Align(id+1)+(n-1)*step > m.opts.MaxId {
+				if err := m.exhausted(n); err != nil {
+					return 0, 0, err
+				}
+				continue
+			}
 		}
 
-		slog.Infof("SQL=%s", createTableSQL)
-		_, err = m.db.Exec(createTableSQL)
+		start, err := m.store.Alloc(m.name, n*step)
 		if err != nil {
-			return err
+			return 0, 0, err
 		}
-	} else {
-		var rowCount int64
-		slog.Infof("SQL=%s", createTableNtSQL)
-		_, err = m.db.Exec(createTableNtSQL)
-		if err != nil {
-			return err
+
+		first = m.opts.Align(start + 1)
+		last = first + (n-1)*step
+		// the ids are allocated by other nodes after the check, handle it on the next loop
+		if m.opts.MaxId > 0 && last > m.opts.MaxId {
+			slog.Warnf("%s: the allocated range (%d, %d] exceeds the max_id %d", m.name, start, start+n*step, m.opts.MaxId)
+			continue
+		}
+		return first, last, nil
+	}
+}
+
+// get next id on the step. must be called on locked.
+func (m *Generator) nextId() (int64, error) {
+	for {
+		next := m.opts.Align(m.current + 1)
+		if m.opts.MaxId > 0 && next > m.opts.MaxId {
+			if err := m.exhausted(1); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		if next > m.batchMax {
+			if err := m.nextSegment(); err != nil {
+				return 0, err
+			}
+			continue
 		}
 
-		// check the value if exist
-		getRowCountSQL := fmt.Sprintf(GetRowCountSQLFormat, m.name)
+		m.current = next
+		m.checkAlert()
+		m.checkPreload()
+		return next, nil
+	}
+}
+
+// handle the id reached the max_id by the exhausted policy, n is the count of the required ids. must be called on locked.
+func (m *Generator) exhausted(n int64) error {
+	switch m.opts.Exhausted {
+	case ExhaustedWrap:
+		return m.wrap(n)
+	case ExhaustedBlock:
+		slog.Warnf("%s: the id reached the max_id %d, block until the max_id is raised", m.name, m.opts.MaxId)
+
+		// NOTICE: don't hold the lock on waiting
+		m.lock.Unlock()
+		time.Sleep(BlockInterval)
+		opts, err := m.store.Options(m.name)
+		m.lock.Lock()
 
-		slog.Infof("SQL=%s", getRowCountSQL)
-		rows, err := m.db.Query(getRowCountSQL)
 		if err != nil {
 			return err
 		}
+		m.opts = opts
+		return nil
+	}
 
-		defer rows.Close()
-		for rows.Next() {
-			err := rows.Scan(&rowCount)
-			if err != nil {
-				return err
-			}
-			break
-		}
+	return ErrIdExhausted
+}
 
-		// has record. update id to latest.
-		// NOTICE: dont update db id value to `idOffset`.
-		if rowCount == int64(1) {
-			m.current, err = m.getLastIdFromDb()
-			if err != nil {
-				return err
-			}
+// wrap the id to the min_id, n is the count of the required ids. must be called on locked.
+// the storage id is wrapped in one conditional operation, so only one node wraps it.
+// if the id has been wrapped by other node, only discard the current segment.
+func (m *Generator) wrap(n int64) error {
+	m.waitLoading()
+	m.next = nil
+
+	// the storage id can't allocate n ids under the max_id, if it's not less than the threshold
+	step := m.opts.StepOr()
+	threshold := m.opts.Align(m.opts.MaxId-step+1) - (n-1)*step
+	if threshold <= m.opts.MinIdOr()-1 {
+		return ErrIdExhausted
+	}
+
+	id, wrapped, err := wrapId(m.store, m.name, threshold, m.opts.MinIdOr()-1)
+	if err != nil {
+		return err
+	}
 
-			m.batchMax = m.current
-			return nil
+	if wrapped {
+		slog.Warnf("%s: the id reached the max_id %d, wrap to the min_id %d", m.name, m.opts.MaxId, m.opts.MinIdOr())
+		appendLedger(m.store, m.name, LedgerWrap, id, id)
+	}
+
+	m.alertMax = 0
+	m.useSegment(&segment{start: id, max: id})
+	return nil
+}
+
+// check the id reached the alert thresholds of the max_id. must be called on locked.
+func (m *Generator) checkAlert() {
+	max := m.opts.MaxId
+	if max <= 0 {
+		return
+	}
+
+	// the max_id is changed
+	if max != m.alertMax {
+		m.alertMax = max
+		m.alertIdx = 0
+		m.alertAt = 0
+	}
+	if m.current < m.alertAt {
+		return
+	}
+
+	alerts := m.opts.AlertsOr(cfg.ExhaustAlerts)
+	for ; m.alertIdx < len(alerts); m.alertIdx++ {
+		threshold := alerts[m.alertIdx]
+		if at := int64(threshold * float64(max)); m.current < at {
+			m.alertAt = at
+			return
 		}
+
+		OnExhaustAlert(m.name, m.current, max, threshold)
 	}
+	m.alertAt = math.MaxInt64
+}
 
-	insertIdSQL := fmt.Sprintf(InsertIdSQLFormat, m.name, idOffset)
-	slog.Infof("SQL=%s", insertIdSQL)
-	_, err = m.db.Exec(insertIdSQL)
+// switch to the preloaded segment, or fetch a new segment from db.
+func (m *Generator) nextSegment() error {
+	m.waitLoading()
+
+	// has been switched by other caller on waiting
+	if m.opts.Align(m.current+1) <= m.batchMax {
+		return nil
+	}
+
+	if m.next != nil {
+		slog.Debugf("%s: switch to preloaded segment (%d, %d]", m.name, m.next.start, m.next.max)
+		m.useSegment(m.next)
+		return nil
+	}
+
+	seg, err := m.fetchSegment(m.batch, m.lastSegment())
 	if err != nil {
-		m.db.Exec(dropTableSQL)
 		return err
 	}
 
-	m.current = idOffset
-	m.batchMax = m.current
+	m.useSegment(seg)
 	return nil
 }
 
-func (m *Generator) DelKeyTable(key string) error {
-	dropTableSQL := fmt.Sprintf(DropTableSQLFormat, key)
+// the current segment. must be called on locked.
+func (m *Generator) lastSegment() *segment {
+	return &segment{start: m.segStart, max: m.batchMax, opts: m.opts, fetchedAt: m.fetchedAt}
+}
+
+// start background preload next segment on the used ratio of current segment reached.
+func (m *Generator) checkPreload() {
+	if !m.doubleBuffer || m.loading || m.next != nil || m.preloadFailed {
+		return
+	}
+
+	size := m.batchMax - m.segStart
+	if size <= 0 || float64(m.current-m.segStart) < float64(size)*m.preloadRatio {
+		return
+	}
+
+	m.loading = true
+	go m.preload(m.batch, m.lastSegment())
+}
+
+func (m *Generator) preload(defBatch int64, last *segment) {
+	// NOTICE: don't hold the lock on query db
+	seg, err := m.fetchSegment(defBatch, last)
 
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	slog.Infof("SQL=%s", dropTableSQL)
-	_, err := m.db.Exec(dropTableSQL)
+	m.loading = false
+	m.loaded.Broadcast()
+
+	if err != nil {
+		slog.Errorf("%s: preload next segment error: %s", m.name, err.Error())
+		// only one attempt per segment, the next segment will be fetched on the current is used up
+		if m.segStart == last.start {
+			m.preloadFailed = true
+		}
+		return
+	}
+	m.next = seg
+}
+
+// wait the background preload finished. must be called on locked.
+func (m *Generator) waitLoading() {
+	for m.loading {
+		m.loaded.Wait()
+	}
+}
+
+// use the segment as current. must be called on locked.
+func (m *Generator) useSegment(seg *segment) {
+	m.segStart = seg.start
+	m.current = seg.start
+	m.batchMax = seg.max
+	m.fetchedAt = seg.fetchedAt
+	m.next = nil
+	m.preloadFailed = false
+	if seg.opts != nil {
+		m.opts = seg.opts
+	}
+}
+
+// fetch a new segment from the storage.
+// the batch count is read from the service options, so all nodes use the same setting.
+// if adaptive batch is enabled, the batch count will be adjusted by the used time of the last segment.
+func (m *Generator) fetchSegment(defBatch int64, last *segment) (*segment, error) {
+	opts, err := m.store.Options(m.name)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	batch := opts.BatchOr(defBatch)
+	if min, max, period, ok := batchRange(opts); ok && !last.fetchedAt.IsZero() {
+		lastBatch := (last.max - last.start) / last.opts.StepOr()
+		batch = adjustBatch(lastBatch, now.Sub(last.fetchedAt), period, min, max)
+		slog.Debugf("%s: adjust batch count to %d", m.name, batch)
+	}
+
+	// the segment contains batch ids on the step
+	size := batch * opts.StepOr()
+	id, err := m.store.Alloc(m.name, size)
+	if err != nil {
+		return nil, err
+	}
+	appendLedger(m.store, m.name, LedgerAlloc, id+1, id+size)
+
+	return &segment{start: id, max: id + size, opts: opts, fetchedAt: now}, nil
+}
+
+// Reset the service id.
+// NOTICE: if force is false and the service exists, will not update the id to `idOffset`,
+// only update current to the latest value.
+func (m *Generator) Reset(idOffset int64, force bool) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	// discard the preloaded segment
+	m.waitLoading()
+	m.next = nil
+
+	id, err := m.store.Reset(m.name, idOffset, force)
 	if err != nil {
 		return err
 	}
+	appendLedger(m.store, m.name, LedgerReset, id, id)
+
+	m.alertMax = 0
+	m.useSegment(&segment{start: id, max: id})
 	return nil
 }
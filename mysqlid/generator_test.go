@@ -0,0 +1,119 @@
+package mysqlid_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/inherelab/genid/mysqlid"
+)
+
+// the storage fails all allocations after the first n
+type failingStorage struct {
+	*mysqlid.MemoryStorage
+	allowed int64
+	allocs  int64
+}
+
+func (s *failingStorage) Alloc(key string, size int64) (int64, error) {
+	if atomic.AddInt64(&s.allocs, 1) > s.allowed {
+		return 0, errors.New("storage is down")
+	}
+	return s.MemoryStorage.Alloc(key, size)
+}
+
+func TestGenerator_preloadOnce(t *testing.T) {
+	store := &failingStorage{MemoryStorage: mysqlid.NewMemoryStorage(), allowed: 1}
+	name := "preload"
+	if _, err := store.Reset(name, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveOptions(name, &mysqlid.Options{Batch: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	gen, _ := mysqlid.NewGenerator(store, name)
+	gen.SetDoubleBuffer(true)
+	if err := gen.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the preload fails on the first id, and is not retried on the rest ids of the segment
+	for i := int64(1); i <= 10; i++ {
+		id, err := gen.Next()
+		if err != nil || id != i {
+			t.Fatalf("the id should be %d, but got %d, err: %v", i, id, err)
+		}
+		mysqlid.WaitPreload(gen)
+	}
+
+	if n := atomic.LoadInt64(&store.allocs); n != 2 {
+		t.Fatalf("should alloc once and preload once, but got %d allocations", n)
+	}
+}
+
+func TestGenerator_fixedBatch(t *testing.T) {
+	c := mysqlid.NewConfig()
+	c.AdaptiveBatch = true
+	mysqlid.SetConfig(c)
+	defer mysqlid.SetConfig(mysqlid.NewConfig())
+
+	store := mysqlid.NewMemoryStorage()
+	name := "fixed_batch"
+	if _, err := store.Reset(name, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveOptions(name, &mysqlid.Options{Batch: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	gen, _ := mysqlid.NewGenerator(store, name)
+	gen.SetDoubleBuffer(false)
+	if err := gen.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second segment is not adjusted to the min_batch
+	for i := 0; i < 11; i++ {
+		if _, err := gen.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if id, _ := store.Current(name); id != 20 {
+		t.Fatalf("the explicit batch 10 should be kept, but the allocated max id is %d", id)
+	}
+}
+
+func TestGenerator_reserveMaxId(t *testing.T) {
+	store := mysqlid.NewMemoryStorage()
+	name := "reserve_max"
+	if _, err := store.Reset(name, 20, false); err != nil {
+		t.Fatal(err)
+	}
+	opts := &mysqlid.Options{Batch: 10, MaxId: 50}
+	if err := store.SaveOptions(name, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	gen, _ := mysqlid.NewGenerator(store, name)
+	gen.SetDoubleBuffer(false)
+	if err := gen.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the ids exceed the max_id, the storage id is not moved
+	cur, _ := store.Current(name)
+	if _, _, err := gen.Reserve(45); err != mysqlid.ErrIdExhausted {
+		t.Fatalf("should returns ErrIdExhausted, but got %v", err)
+	}
+	if id, _ := store.Current(name); id != cur {
+		t.Fatalf("the storage id should be kept %d, but got %d", cur, id)
+	}
+
+	// wrap to the min_id by the exhausted policy
+	opts.Exhausted = mysqlid.ExhaustedWrap
+	gen.SetOptions(opts)
+	if first, last, err := gen.Reserve(45); err != nil || first != 1 || last != 45 {
+		t.Fatalf("the ids should be wrapped to [1, 45], but got [%d, %d], err: %v", first, last, err)
+	}
+}
@@ -0,0 +1,222 @@
+package mysqlid
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gookit/slog"
+)
+
+// MaxLeaseCount the max count of ids on lease a range once
+const MaxLeaseCount = 10000000
+
+// ErrLeaseNotExists the range lease not exists
+var ErrLeaseNotExists = errors.New("the range lease not exists")
+
+// RangeLease the id range [Start, End] leased to a client, the client allocates the ids locally.
+// the ids are Start, Start+Step, ... End.
+type RangeLease struct {
+	Id     int64  `json:"id"`
+	Key    string `json:"name"`
+	Client string `json:"client"`
+	Start  int64  `json:"start"`
+	End    int64  `json:"end"`
+	Step   int64  `json:"step"`
+	// Used the consumed count of ids reported by the client
+	Used       int64     `json:"used"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReportedAt time.Time `json:"reported_at,omitempty"`
+}
+
+// Size get the count of ids in the range
+func (l *RangeLease) Size() int64 {
+	if l.Step > 1 {
+		return (l.End-l.Start)/l.Step + 1
+	}
+	return l.End - l.Start + 1
+}
+
+// RangeLeaser the storage can record the range leases
+type RangeLeaser interface {
+	// SaveLease record the leased range, and set the lease id
+	SaveLease(lease *RangeLease) error
+	// ReportLease update the consumed count of the lease
+	ReportLease(id, used int64) error
+	// Leases list the range leases of the key
+	Leases(key string) ([]*RangeLease, error)
+}
+
+// the lease table is created next to the manager table, named Config.TableName + "_leases"
+const (
+	LeaseTableSuffix = "_leases"
+
+	CreateLeaseTableSQLFormat = `CREATE TABLE IF NOT EXISTS %s (
+    id bigint(20) unsigned NOT NULL auto_increment,
+    k VARCHAR(255) NOT NULL COMMENT 'service name',
+    client VARCHAR(255) NOT NULL DEFAULT '' COMMENT 'the client leased the range',
+    start_id bigint(20) unsigned NOT NULL COMMENT 'the range start, included',
+    end_id bigint(20) unsigned NOT NULL COMMENT 'the range end, included',
+    step bigint(20) unsigned NOT NULL DEFAULT 1 COMMENT 'the step of ids in the range',
+    used bigint(20) unsigned NOT NULL DEFAULT 0 COMMENT 'the consumed count reported by the client',
+    created_at bigint(20) NOT NULL DEFAULT 0 COMMENT 'unix seconds',
+    reported_at bigint(20) NOT NULL DEFAULT 0 COMMENT 'unix seconds',
+    PRIMARY KEY (id),
+    KEY idx_k (k)
+) ENGINE=Innodb DEFAULT CHARSET=utf8`
+
+	InsertLeaseSQLFormat = "INSERT INTO `%s` (`k`, `client`, `start_id`, `end_id`, `step`, `created_at`) VALUES (?, ?, ?, ?, ?, ?)"
+	ReportLeaseSQLFormat = "UPDATE `%s` SET `used` = ?, `reported_at` = ? WHERE `id` = ?"
+	SelectLeaseSQLFormat = "SELECT `id`, `k`, `client`, `start_id`, `end_id`, `step`, `used`, `created_at`, `reported_at` FROM `%s` WHERE `k` = ? ORDER BY `id`"
+)
+
+func (t *mysqlTable) leaseTable() string {
+	return t.table + LeaseTableSuffix
+}
+
+// create the lease table on first use
+func (t *mysqlTable) initLeaseTable() error {
+	t.leaseLock.Lock()
+	defer t.leaseLock.Unlock()
+
+	if t.leaseReady {
+		return nil
+	}
+
+	createTableSQL := fmt.Sprintf(CreateLeaseTableSQLFormat, t.leaseTable())
+	slog.Infof("SQL=%s", createTableSQL)
+	if _, err := t.db.Exec(createTableSQL); err != nil {
+		return err
+	}
+
+	t.leaseReady = true
+	return nil
+}
+
+// SaveLease record the leased range
+func (t *mysqlTable) SaveLease(lease *RangeLease) error {
+	if err := t.initLeaseTable(); err != nil {
+		return err
+	}
+
+	insertSQL := fmt.Sprintf(InsertLeaseSQLFormat, t.leaseTable())
+	slog.Infof("SQL=%s key=%s client=%s range=[%d, %d]", insertSQL, lease.Key, lease.Client, lease.Start, lease.End)
+	ret, err := t.db.Exec(insertSQL, lease.Key, lease.Client, lease.Start, lease.End, lease.Step, lease.CreatedAt.Unix())
+	if err != nil {
+		return err
+	}
+
+	lease.Id, err = ret.LastInsertId()
+	return err
+}
+
+// ReportLease update the consumed count of the lease
+func (t *mysqlTable) ReportLease(id, used int64) error {
+	if err := t.initLeaseTable(); err != nil {
+		return err
+	}
+
+	reportSQL := fmt.Sprintf(ReportLeaseSQLFormat, t.leaseTable())
+	slog.Infof("SQL=%s id=%d used=%d", reportSQL, id, used)
+	ret, err := t.db.Exec(reportSQL, used, time.Now().Unix(), id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := ret.RowsAffected(); err == nil && n == 0 {
+		return ErrLeaseNotExists
+	}
+	return nil
+}
+
+// Leases list the range leases of the key
+func (t *mysqlTable) Leases(key string) ([]*RangeLease, error) {
+	if err := t.initLeaseTable(); err != nil {
+		return nil, err
+	}
+
+	selectSQL := fmt.Sprintf(SelectLeaseSQLFormat, t.leaseTable())
+	slog.Infof("SQL=%s key=%s", selectSQL, key)
+	rows, err := t.db.Query(selectSQL, key)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	return ScanLeases(rows)
+}
+
+// ScanLeases scan the range leases from the rows, the columns are same as the SelectLeaseSQLFormat.
+// the time columns are unix seconds, it's shared by the SQL storages.
+func ScanLeases(rows *sql.Rows) ([]*RangeLease, error) {
+	var leases []*RangeLease
+	for rows.Next() {
+		var createdAt, reportedAt int64
+		l := &RangeLease{}
+
+		err := rows.Scan(&l.Id, &l.Key, &l.Client, &l.Start, &l.End, &l.Step, &l.Used, &createdAt, &reportedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		l.CreatedAt = time.Unix(createdAt, 0)
+		if reportedAt > 0 {
+			l.ReportedAt = time.Unix(reportedAt, 0)
+		}
+		leases = append(leases, l)
+	}
+
+	return leases, rows.Err()
+}
+
+// the range leases on the memory storage
+type memoryLeases struct {
+	lock   sync.Mutex
+	lastId int64
+	leases []*RangeLease
+}
+
+// SaveLease record the leased range
+func (s *memoryLeases) SaveLease(lease *RangeLease) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.lastId++
+	lease.Id = s.lastId
+
+	l := *lease
+	s.leases = append(s.leases, &l)
+	return nil
+}
+
+// ReportLease update the consumed count of the lease
+func (s *memoryLeases) ReportLease(id, used int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, l := range s.leases {
+		if l.Id == id {
+			l.Used = used
+			l.ReportedAt = time.Now()
+			return nil
+		}
+	}
+	return ErrLeaseNotExists
+}
+
+// Leases list the range leases of the key
+func (s *memoryLeases) Leases(key string) ([]*RangeLease, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var leases []*RangeLease
+	for _, l := range s.leases {
+		if l.Key == key {
+			cp := *l
+			leases = append(leases, &cp)
+		}
+	}
+	return leases, nil
+}
@@ -0,0 +1,260 @@
+package mysqlid
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gookit/slog"
+)
+
+// the reasons of the ledger entries
+const (
+	// LedgerAlloc a segment is allocated by the generator
+	LedgerAlloc = "alloc"
+	// LedgerReset the id is reset by SET
+	LedgerReset = "reset"
+	// LedgerWrap the id is wrapped to the min_id on reached the max_id
+	LedgerWrap = "wrap"
+	// LedgerLease a range is leased to the client
+	LedgerLease = "lease"
+
+	// DefaultLedgerLimit the default max count of the entries on query
+	DefaultLedgerLimit = 100
+	// MaxLedgerLimit the max count of the entries on query
+	MaxLedgerLimit = 10000
+)
+
+// LedgerEntry a record of the ids allocation.
+// the allocated ids are in [Start, End], on reset or wrap, the Start and End are the current id after reset.
+type LedgerEntry struct {
+	Id        int64     `json:"id"`
+	Key       string    `json:"name"`
+	Start     int64     `json:"start"`
+	End       int64     `json:"end"`
+	Node      string    `json:"node"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LedgerQuery the conditions of query the ledger entries
+type LedgerQuery struct {
+	// Key the service name, query all services if empty
+	Key string
+	// IdIn query the entries which [Start, End] contains the id, if greater than 0
+	IdIn int64
+	// Limit the max count of entries, default is DefaultLedgerLimit. the latest entries first.
+	Limit int
+}
+
+// LimitOr get the limit of the query
+func (q *LedgerQuery) LimitOr() int {
+	if q.Limit <= 0 {
+		return DefaultLedgerLimit
+	}
+	if q.Limit > MaxLedgerLimit {
+		return MaxLedgerLimit
+	}
+	return q.Limit
+}
+
+// match check the entry matches the query
+func (q *LedgerQuery) match(e *LedgerEntry) bool {
+	if q.Key != "" && q.Key != e.Key {
+		return false
+	}
+	return q.IdIn <= 0 || (e.Start <= q.IdIn && q.IdIn <= e.End)
+}
+
+// Ledger the storage can record the ids allocation, for auditing.
+type Ledger interface {
+	// AppendLedger append the entry to the ledger, and set the entry id
+	AppendLedger(e *LedgerEntry) error
+	// LedgerEntries query the ledger entries, the latest entries first.
+	LedgerEntries(q *LedgerQuery) ([]*LedgerEntry, error)
+}
+
+var (
+	nodeOnce sync.Once
+	nodeName string
+)
+
+// NodeName get the identity of the node on the ledger, Config.NodeName or "hostname-pid"
+func NodeName() string {
+	if cfg.NodeName != "" {
+		return cfg.NodeName
+	}
+
+	nodeOnce.Do(func() {
+		host, _ := os.Hostname()
+		nodeName = fmt.Sprintf("%s-%d", host, os.Getpid())
+	})
+	return nodeName
+}
+
+// append the entry to the ledger of the storage, if Config.Ledger is enabled.
+// the entry is written synchronously under the lock of the generator. the ids have been allocated,
+// so the error is only logged, and the failed entry leaves a gap in the trail.
+func appendLedger(store Storage, key, reason string, start, end int64) {
+	if !cfg.Ledger {
+		return
+	}
+
+	ledger, ok := store.(Ledger)
+	if !ok {
+		return
+	}
+
+	e := &LedgerEntry{
+		Key:       key,
+		Start:     start,
+		End:       end,
+		Node:      NodeName(),
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	}
+	if err := ledger.AppendLedger(e); err != nil {
+		slog.Errorf("%s: append the ledger [%d, %d] %s error: %s", key, start, end, reason, err.Error())
+	}
+}
+
+// the ledger table is created next to the manager table, named Config.TableName + "_ledger"
+const (
+	LedgerTableSuffix = "_ledger"
+
+	CreateLedgerTableSQLFormat = `CREATE TABLE IF NOT EXISTS %s (
+    id bigint(20) unsigned NOT NULL auto_increment,
+    k VARCHAR(255) NOT NULL COMMENT 'service name',
+    start_id bigint(20) NOT NULL COMMENT 'the range start, included',
+    end_id bigint(20) NOT NULL COMMENT 'the range end, included',
+    node VARCHAR(255) NOT NULL DEFAULT '' COMMENT 'the node allocated the range',
+    reason VARCHAR(32) NOT NULL DEFAULT '' COMMENT 'alloc, reset, wrap, lease',
+    created_at bigint(20) NOT NULL DEFAULT 0 COMMENT 'unix milliseconds',
+    PRIMARY KEY (id),
+    KEY idx_k_end (k, end_id)
+) ENGINE=Innodb DEFAULT CHARSET=utf8`
+
+	InsertLedgerSQLFormat = "INSERT INTO `%s` (`k`, `start_id`, `end_id`, `node`, `reason`, `created_at`) VALUES (?, ?, ?, ?, ?, ?)"
+	SelectLedgerSQLFormat = "SELECT `id`, `k`, `start_id`, `end_id`, `node`, `reason`, `created_at` FROM `%s`%s ORDER BY `id` DESC LIMIT %d"
+)
+
+func (t *mysqlTable) ledgerTable() string {
+	return t.table + LedgerTableSuffix
+}
+
+// create the ledger table on first use
+func (t *mysqlTable) initLedgerTable() error {
+	t.ledgerLock.Lock()
+	defer t.ledgerLock.Unlock()
+
+	if t.ledgerReady {
+		return nil
+	}
+
+	createTableSQL := fmt.Sprintf(CreateLedgerTableSQLFormat, t.ledgerTable())
+	slog.Infof("SQL=%s", createTableSQL)
+	if _, err := t.db.Exec(createTableSQL); err != nil {
+		return err
+	}
+
+	t.ledgerReady = true
+	return nil
+}
+
+// AppendLedger append the entry to the ledger table
+func (t *mysqlTable) AppendLedger(e *LedgerEntry) error {
+	if err := t.initLedgerTable(); err != nil {
+		return err
+	}
+
+	insertSQL := fmt.Sprintf(InsertLedgerSQLFormat, t.ledgerTable())
+	slog.Debugf("SQL=%s key=%s range=[%d, %d] reason=%s", insertSQL, e.Key, e.Start, e.End, e.Reason)
+	ret, err := t.db.Exec(insertSQL, e.Key, e.Start, e.End, e.Node, e.Reason, e.CreatedAt.UnixNano()/int64(time.Millisecond))
+	if err != nil {
+		return err
+	}
+
+	e.Id, err = ret.LastInsertId()
+	return err
+}
+
+// LedgerEntries query the ledger entries, the latest entries first.
+func (t *mysqlTable) LedgerEntries(q *LedgerQuery) ([]*LedgerEntry, error) {
+	if err := t.initLedgerTable(); err != nil {
+		return nil, err
+	}
+
+	var conds []string
+	var args []interface{}
+	if q.Key != "" {
+		conds = append(conds, "`k` = ?")
+		args = append(args, q.Key)
+	}
+	if q.IdIn > 0 {
+		conds = append(conds, "`start_id` <= ? AND `end_id` >= ?")
+		args = append(args, q.IdIn, q.IdIn)
+	}
+
+	var where string
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	selectSQL := fmt.Sprintf(SelectLedgerSQLFormat, t.ledgerTable(), where, q.LimitOr())
+	slog.Infof("SQL=%s args=%v", selectSQL, args)
+	rows, err := t.db.Query(selectSQL, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var entries []*LedgerEntry
+	for rows.Next() {
+		var createdAt int64
+		e := &LedgerEntry{}
+		if err = rows.Scan(&e.Id, &e.Key, &e.Start, &e.End, &e.Node, &e.Reason, &createdAt); err != nil {
+			return nil, err
+		}
+
+		e.CreatedAt = time.Unix(0, createdAt*int64(time.Millisecond))
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// the ledger on the memory storage
+type memoryLedger struct {
+	ledgerLock sync.Mutex
+	entries    []*LedgerEntry
+}
+
+// AppendLedger append the entry to the ledger
+func (s *memoryLedger) AppendLedger(e *LedgerEntry) error {
+	s.ledgerLock.Lock()
+	defer s.ledgerLock.Unlock()
+
+	e.Id = int64(len(s.entries)) + 1
+	entry := *e
+	s.entries = append(s.entries, &entry)
+	return nil
+}
+
+// LedgerEntries query the ledger entries, the latest entries first.
+func (s *memoryLedger) LedgerEntries(q *LedgerQuery) ([]*LedgerEntry, error) {
+	s.ledgerLock.Lock()
+	defer s.ledgerLock.Unlock()
+
+	limit := q.LimitOr()
+	entries := make([]*LedgerEntry, 0)
+	for i := len(s.entries) - 1; i >= 0 && len(entries) < limit; i-- {
+		if q.match(s.entries[i]) {
+			e := *s.entries[i]
+			entries = append(entries, &e)
+		}
+	}
+	return entries, nil
+}
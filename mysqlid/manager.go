@@ -1,63 +1,56 @@
 package mysqlid
 
 import (
-	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/gookit/slog"
-)
-
-const (
-	ManagerTableName = "_idgen_manager"
-
-	CreateRecordTableSQLFormat = `
-CREATE TABLE %s (
-	k VARCHAR(255) NOT NULL COMMENT 'service name',
-	PRIMARY KEY (k)
-) ENGINE=Innodb DEFAULT CHARSET=utf8`
-
-	// create name table if not exist
-	CreateRecordTableNTSQLFormat = `
-CREATE TABLE IF NOT EXISTS %s (
-	k VARCHAR(255) NOT NULL COMMENT 'service name',
-	PRIMARY KEY (k)
-) ENGINE=Innodb DEFAULT CHARSET=utf8`
-
-	InsertKeySQLFormat  = "INSERT INTO %s (`k`) VALUES ('%s')"
-	SelectKeySQLFormat  = "SELECT `k` FROM `%s` WHERE `k` = '%s'"
-	SelectKeysSQLFormat = "SELECT `k` FROM `%s`"
-	DeleteKeySQLFormat  = "DELETE FROM `%s` WHERE `k` = '%s'"
+	"github.com/inherelab/genid"
+	"github.com/inherelab/genid/hashid"
+	"github.com/inherelab/genid/snowflake"
 )
 
 var (
 	ErrServiceNotExists = errors.New("service not exists")
+	// ErrTypeChanged the type of the existing service can not be changed, other nodes may serve it by the cached generator.
+	ErrTypeChanged = errors.New("can not change the type or scope of the existing service, delete it and create again")
 )
 
 // Manager struct
 type Manager struct {
 	sync.RWMutex
-	db *sql.DB
+	store Storage
 
 	initialized  bool
-	generatorMap map[string]*Generator
+	generatorMap map[string]ServiceGenerator
+
+	// the settings of the snowflake services, the WorkerId maybe leased from the storage
+	snowflake *snowflake.Config
+	lease     *workerLease
+
+	// the parsed format templates and the id encoders of the services
+	fmtLock    sync.Mutex
+	formatters map[string]*formatter
+	encoders   map[string]*hashid.Encoder
 }
 
 // NewEmptyManager instance
 func NewEmptyManager() *Manager {
 	return &Manager{
-		generatorMap: make(map[string]*Generator),
+		generatorMap: make(map[string]ServiceGenerator),
 	}
 }
 
 // NewManager instance
-func NewManager(db *sql.DB) *Manager {
+func NewManager(store Storage) *Manager {
 	return &Manager{
-		db: db,
+		store: store,
 		// init map
-		generatorMap: make(map[string]*Generator),
+		generatorMap: make(map[string]ServiceGenerator),
 	}
 }
 
@@ -68,161 +61,157 @@ func (s *Manager) Init() error {
 		return nil
 	}
 
-	slog.Info("init load all services info from DB")
-	createTableNtSQL := fmt.Sprintf(CreateRecordTableNTSQLFormat, ManagerTableName)
-	selectKeysSQL := fmt.Sprintf(SelectKeysSQLFormat, ManagerTableName)
-
-	slog.Infof("SQL=%s", createTableNtSQL)
-	_, err := s.db.Exec(createTableNtSQL)
+	slog.Info("init load all services info from storage")
+	err := s.store.Init()
 	if err != nil {
 		return err
 	}
 
-	slog.Infof("SQL=%s", selectKeysSQL)
-	rows, err := s.db.Query(selectKeysSQL)
+	// the allocations should not be skipped silently on the ledger
+	if _, ok := s.store.(Ledger); cfg.Ledger && !ok {
+		return fmt.Errorf("the storage %T not support the ledger", s.store)
+	}
+
+	if err = s.initSnowflake(); err != nil {
+		return err
+	}
+
+	keys, err := s.store.Keys()
 	if err != nil {
 		return err
 	}
 
-	defer rows.Close()
-	for rows.Next() {
-		serviceName := ""
-		err := rows.Scan(&serviceName)
+	// load options first, the bucket keys of the scoped services are not the services.
+	optsMap := make(map[string]*Options, len(keys))
+	scopes := make(map[string]string)
+	for _, serviceName := range keys {
+		opts, err := s.store.Options(serviceName)
 		if err != nil {
 			return err
 		}
 
-		if serviceName == "" {
-			continue
+		optsMap[serviceName] = opts
+		if opts.kind() == typeScoped {
+			scopes[serviceName] = opts.Scope
 		}
+	}
 
-		gen, ok := s.generatorMap[serviceName]
-		if ok == false {
-			isExist, err := s.TableExist(serviceName)
-			if err != nil {
-				return err
-			}
-
-			if isExist {
-				gen, err = NewGenerator(s.db, serviceName)
-				if err != nil {
-					return err
-				}
+	for _, serviceName := range keys {
+		if _, ok := s.generatorMap[serviceName]; ok {
+			continue
+		}
+		if isAnyBucketKey(serviceName, scopes) {
+			continue
+		}
 
-				// TODO should init ?
-				if err = gen.Init(); err != nil {
-					return err
-				}
+		gen, err := s.newGenerator(serviceName, optsMap[serviceName].kind())
+		if err != nil {
+			return err
+		}
 
-				// storage
-				s.generatorMap[serviceName] = gen
-			}
+		// TODO should init ?
+		if err = gen.Init(); err != nil {
+			return err
 		}
+
+		// storage
+		s.generatorMap[serviceName] = gen
 	}
 
 	s.initialized = true
 	return nil
 }
 
-// TableExist
-// func (s *Manager) IsKeyExist(key string) (bool, error) {
-func (s *Manager) TableExist(key string) (bool, error) {
-	var tableName string
-	var haveValue bool
-
-	if len(key) == 0 {
-		return false, nil
+// lease the snowflake worker id from the storage, if enabled Config.Snowflake.WorkerLease
+func (s *Manager) initSnowflake() error {
+	sfCfg := *cfg.Snowflake
+	s.snowflake = &sfCfg
+	if !sfCfg.WorkerLease {
+		return nil
 	}
 
-	getKeySQL := fmt.Sprintf(GetKeySQLFormat, key)
-	slog.Infof("SQL=%s", getKeySQL)
-	rows, err := s.db.Query(getKeySQL)
-	if err != nil {
-		return false, err
+	leaser, ok := s.store.(WorkerLeaser)
+	if !ok {
+		return fmt.Errorf("the storage %T not support lease the worker id", s.store)
 	}
 
-	defer rows.Close()
-	for rows.Next() {
-		err := rows.Scan(&tableName)
-		if err != nil {
-			return false, err
-		}
-		haveValue = true
+	ttl := time.Duration(sfCfg.LeaseTTL) * time.Second
+	if ttl <= 0 {
+		ttl = snowflake.DefaultLeaseTTL * time.Second
 	}
 
-	if haveValue == false {
-		return false, nil
+	lease, err := leaseWorker(leaser, sfCfg.MaxWorkerId(), ttl)
+	if err != nil {
+		return err
 	}
-	return true, nil
-}
 
-// GetKey This is mainly used to confirm the existence of the service name in the DB
-// 这里主要用于确认DB中服务名存在
-func (s *Manager) GetKey(key string) (string, error) {
-	keyName := ""
-	selectKeySQL := fmt.Sprintf(SelectKeySQLFormat, ManagerTableName, key)
+	s.lease = lease
+	s.snowflake.WorkerId = lease.WorkerId()
+	return nil
+}
 
-	slog.Infof("SQL=%s", selectKeySQL)
-	rows, err := s.db.Query(selectKeySQL)
-	if err != nil {
-		return keyName, err
+// create the service generator by the service kind, see Options.kind()
+func (s *Manager) newGenerator(serviceName, typ string) (ServiceGenerator, error) {
+	switch typ {
+	case TypeULID, TypeUUIDv7:
+		return NewStringService(s.store, serviceName, typ), nil
+	case TypeSnowflake:
+		return s.newSnowflake(serviceName)
+	case typeScoped:
+		return NewScopedService(s.store, serviceName), nil
 	}
+	return NewGenerator(s.store, serviceName)
+}
 
-	defer rows.Close()
-	for rows.Next() {
-		err := rows.Scan(&keyName)
-		if err != nil {
-			return keyName, err
-		}
+func (s *Manager) newSnowflake(serviceName string) (ServiceGenerator, error) {
+	sfCfg := s.snowflake
+	if sfCfg == nil {
+		sfCfg = cfg.Snowflake
+	}
+	if s.lease != nil {
+		c := *sfCfg
+		c.WorkerId = s.lease.WorkerId()
+		sfCfg = &c
 	}
 
-	if keyName == "" {
-		return keyName, fmt.Errorf("%s: not exists name", key)
+	gen, err := NewSnowflakeService(s.store, serviceName, sfCfg)
+	if err != nil {
+		return nil, err
 	}
-	return keyName, nil
+
+	gen.lease = s.lease
+	return gen, nil
 }
 
-func (s *Manager) SetKey(key string) error {
-	if len(key) == 0 {
-		return fmt.Errorf("%s: invalid name", key)
+// WorkerId get the worker id of the snowflake services
+func (s *Manager) WorkerId() int64 {
+	if s.lease != nil {
+		return s.lease.WorkerId()
+	}
+	if s.snowflake == nil {
+		return cfg.Snowflake.WorkerId
 	}
+	return s.snowflake.WorkerId
+}
 
-	// service name record exists on manager table.
-	_, err := s.GetKey(key)
-	if err == nil {
+// Close the manager, release the leased worker id.
+func (s *Manager) Close() error {
+	if s.lease == nil {
 		return nil
 	}
-	// if err != nil {
-	// 	return err
-	// }
-
-	insertKeySQL := fmt.Sprintf(InsertKeySQLFormat, ManagerTableName, key)
-	slog.Infof("SQL=%s", insertKeySQL)
-	_, err = s.db.Exec(insertKeySQL)
 
+	err := s.lease.Close()
+	s.lease = nil
 	return err
 }
 
-func (s *Manager) DelKey(key string) error {
-	if len(key) == 0 {
-		return fmt.Errorf("%s: invalid name", key)
-	}
-
-	_, err := s.GetKey(key)
-	if err == nil {
-		deleteKeySQL := fmt.Sprintf(DeleteKeySQLFormat, ManagerTableName, key)
-		slog.Infof("SQL=%s", deleteKeySQL)
-		_, err = s.db.Exec(deleteKeySQL)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
+// Storage get the storage of the manager
+func (s *Manager) Storage() Storage {
+	return s.store
 }
 
 // GetGenerator by service name
-func (s *Manager) GetGenerator(serviceName string) (*Generator, error) {
+func (s *Manager) GetGenerator(serviceName string) (ServiceGenerator, error) {
 	s.Lock()
 	gen, ok := s.generatorMap[serviceName]
 	if ok == false {
@@ -235,19 +224,19 @@ func (s *Manager) GetGenerator(serviceName string) (*Generator, error) {
 }
 
 // GetOrNewGenerator by service name
-func (s *Manager) GetOrNewGenerator(serviceName string) (*Generator, error) {
+func (s *Manager) GetOrNewGenerator(serviceName string) (ServiceGenerator, error) {
 	s.Lock()
 	defer s.Unlock()
 
 	return s.getOrNewGenerator(serviceName)
 }
 
-func (s *Manager) getOrNewGenerator(serviceName string) (*Generator, error) {
+func (s *Manager) getOrNewGenerator(serviceName string) (ServiceGenerator, error) {
 	gen, ok := s.generatorMap[serviceName]
 	if ok == false {
 		var err error
 		// not exists, create it.
-		gen, err = NewGenerator(s.db, serviceName)
+		gen, err = s.newGenerator(serviceName, TypeSegment)
 		if err != nil {
 			return nil, err
 		}
@@ -260,6 +249,9 @@ func (s *Manager) getOrNewGenerator(serviceName string) (*Generator, error) {
 
 // ListServices list all exists services
 func (s *Manager) ListServices() map[string]int64 {
+	s.RLock()
+	defer s.RUnlock()
+
 	mp := make(map[string]int64, len(s.generatorMap))
 	for name, gen := range s.generatorMap {
 		mp[name] = gen.Current()
@@ -288,13 +280,12 @@ func (s *Manager) DelService(serviceName string) error {
 
 	// exists
 	if ok {
-		err := gen.DelKeyTable(serviceName)
-		if err != nil {
-			return err
+		if sg, isScoped := gen.(*ScopedService); isScoped {
+			if err := sg.DeleteBuckets(); err != nil {
+				return err
+			}
 		}
-
-		err = s.DelKey(serviceName)
-		return err
+		return s.store.Delete(gen.Name())
 	}
 
 	return errors.New("service name not exists")
@@ -314,14 +305,127 @@ func (s *Manager) SetServiceId(serviceName string, lastId int64, force bool) (in
 		return 0, err
 	}
 
-	err = s.SetKey(serviceName)
+	err = gen.Reset(lastId, force)
+
+	return gen.Current(), err
+}
+
+// SetServiceBatch set the batch count of fetch ids from db once for the service.
+// the setting is saved to the manager table, all nodes will use it on fetch next segment.
+// if batch is 0, will use the default Config.BatchCount
+//
+// Usage:
+//	SetServiceBatch("service_order", 10000)
+func (s *Manager) SetServiceBatch(serviceName string, batch int64) error {
+	return s.SetServiceOptions(serviceName, map[string]string{
+		"batch": strconv.FormatInt(batch, 10),
+	})
+}
+
+// SetService set the service latest id and options, see SetServiceId and SetServiceOptions.
+// the service type and scope can only be set on create the service, returns ErrTypeChanged if change them of the existing service.
+//
+// Usage:
+//	SetService("service_order", 0, false, map[string]string{"type": "snowflake"})
+func (s *Manager) SetService(serviceName string, lastId int64, force bool, kvMap map[string]string) (int64, error) {
+	if len(kvMap) == 0 || s.ServiceExists(serviceName) {
+		return s.setService(serviceName, lastId, force, kvMap)
+	}
+
+	exists, err := s.store.Exists(serviceName)
 	if err != nil {
 		return 0, err
 	}
+	if exists {
+		return s.setService(serviceName, lastId, force, kvMap)
+	}
 
-	err = gen.Reset(lastId, force)
+	return s.createService(serviceName, lastId, kvMap)
+}
 
-	return gen.Current(), err
+func (s *Manager) setService(serviceName string, lastId int64, force bool, kvMap map[string]string) (int64, error) {
+	id, err := s.SetServiceId(serviceName, lastId, force)
+	if err != nil || len(kvMap) == 0 {
+		return id, err
+	}
+
+	return id, s.SetServiceOptions(serviceName, kvMap)
+}
+
+// create the service generator by the type of the options
+func (s *Manager) createService(serviceName string, lastId int64, kvMap map[string]string) (int64, error) {
+	opts := Options{}
+	for name, val := range kvMap {
+		if err := opts.Set(name, val); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := opts.Validate(); err != nil {
+		return 0, err
+	}
+
+	gen, err := s.newGenerator(serviceName, opts.kind())
+	if err != nil {
+		return 0, err
+	}
+
+	// create the key and save the options, then load them and set the id of the new key
+	if _, err = s.store.Reset(serviceName, 0, false); err != nil {
+		return 0, err
+	}
+	if err = s.store.SaveOptions(serviceName, &opts); err != nil {
+		return 0, err
+	}
+	if err = gen.Init(); err != nil {
+		return 0, err
+	}
+	if err = gen.Reset(lastId, true); err != nil {
+		return 0, err
+	}
+
+	slog.Infof("create the service %s, type=%s", serviceName, opts.kind())
+	s.Lock()
+	s.generatorMap[serviceName] = gen
+	s.Unlock()
+	return gen.Current(), nil
+}
+
+// SetServiceOptions set options for the service, the options is saved to the manager table.
+// the type and scope can not be changed, returns ErrTypeChanged. because other nodes keep serving the service
+// by the cached generator, the ids of different types are handed out. set them on create the service by SetService.
+//
+// Usage:
+//	SetServiceOptions("service_order", map[string]string{"min_batch": "1000", "max_batch": "100000"})
+func (s *Manager) SetServiceOptions(serviceName string, kvMap map[string]string) error {
+	gen, err := s.GetGenerator(serviceName)
+	if err != nil {
+		return err
+	}
+
+	old := gen.Options()
+	opts := old
+	for name, val := range kvMap {
+		if err = opts.Set(name, val); err != nil {
+			return err
+		}
+	}
+
+	if err = opts.Validate(); err != nil {
+		return err
+	}
+
+	if opts.kind() != old.kind() {
+		return ErrTypeChanged
+	}
+
+	err = s.store.SaveOptions(serviceName, &opts)
+	if err != nil {
+		return err
+	}
+
+	gen.SetOptions(&opts)
+	return nil
 }
 
 // SetServices set multi service latest ids
@@ -367,6 +471,423 @@ func (s *Manager) NextId(serviceName string) (int64, error) {
 	return id, nil
 }
 
+// IncrBy reserve n contiguous ids of the service, returns the last id. like the redis INCRBY.
+// returns ErrServiceNotExists if the service not exists, and only the segment service can reserve more than one id.
+//
+// Usage:
+//	last, err := IncrBy("service_order", 100) // the ids are last-99 ~ last
+func (s *Manager) IncrBy(serviceName string, n int64) (int64, error) {
+	if n < 1 || n > MaxLeaseCount {
+		return 0, fmt.Errorf("the count of ids must be in 1 ~ %d", MaxLeaseCount)
+	}
+
+	gen, err := s.GetGenerator(serviceName)
+	if err != nil {
+		return 0, err
+	}
+
+	if n == 1 {
+		return gen.Next()
+	}
+
+	seg, ok := gen.(*Generator)
+	if !ok {
+		return 0, fmt.Errorf("the service %s is not the segment type, can not reserve ids", serviceName)
+	}
+
+	_, last, err := seg.Reserve(n)
+	return last, err
+}
+
+// NextIds generate n ids of the service
+func (s *Manager) NextIds(serviceName string, n int) ([]int64, error) {
+	if err := checkBulkCount(n); err != nil {
+		return nil, err
+	}
+
+	gen, err := s.GetGenerator(serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	if bg, ok := gen.(BulkGenerator); ok {
+		return bg.NextN(n)
+	}
+
+	ids := make([]int64, n)
+	for i := range ids {
+		if ids[i], err = gen.Next(); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// NextStrings generate n ids of the service as string
+func (s *Manager) NextStrings(serviceName string, n int) ([]string, error) {
+	if err := checkBulkCount(n); err != nil {
+		return nil, err
+	}
+
+	gen, err := s.GetGenerator(serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	if bg, ok := gen.(BulkStringGenerator); ok {
+		return bg.NextStrings(n)
+	}
+
+	ids, err := s.NextIds(serviceName, n)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := s.formatter(gen, "")
+	if err != nil {
+		return nil, err
+	}
+
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = f.Format(id)
+	}
+	return strs, nil
+}
+
+func checkBulkCount(n int) error {
+	if n < 1 || n > MaxBulkCount {
+		return fmt.Errorf("the count of ids must be in 1 ~ %d", MaxBulkCount)
+	}
+	return nil
+}
+
+// LeaseRange lease a range of n ids to the client, the client allocates the ids locally.
+// the range is allocated from the storage directly, and recorded by the storage.
+// if the range exceeds the max_id, it's handled by the exhausted policy of the service like NextId.
+func (s *Manager) LeaseRange(serviceName, client string, n int64) (*RangeLease, error) {
+	if n < 1 || n > MaxLeaseCount {
+		return nil, fmt.Errorf("the count of lease ids must be in 1 ~ %d", MaxLeaseCount)
+	}
+
+	leaser, err := s.rangeLeaser()
+	if err != nil {
+		return nil, err
+	}
+
+	gen, err := s.GetGenerator(serviceName)
+	if err != nil {
+		return nil, err
+	}
+	g, ok := gen.(*Generator)
+	if !ok {
+		return nil, fmt.Errorf("the service %s is not the segment type, can not lease range", serviceName)
+	}
+
+	// the max_id is checked before allocating, and handled by the exhausted policy
+	first, last, err := g.AllocRange(n)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := g.Options()
+	lease := &RangeLease{
+		Key:       serviceName,
+		Client:    client,
+		Start:     first,
+		End:       last,
+		Step:      opts.StepOr(),
+		CreatedAt: time.Now(),
+	}
+
+	slog.Infof("lease the range [%d, %d] of service %s to client %s", lease.Start, lease.End, serviceName, client)
+	appendLedger(s.store, serviceName, LedgerLease, lease.Start, lease.End)
+	return lease, leaser.SaveLease(lease)
+}
+
+// ReportLease report the consumed count of the range lease
+func (s *Manager) ReportLease(leaseId, used int64) error {
+	if used < 0 {
+		return fmt.Errorf("invalid used count: %d", used)
+	}
+
+	leaser, err := s.rangeLeaser()
+	if err != nil {
+		return err
+	}
+	return leaser.ReportLease(leaseId, used)
+}
+
+// ListLeases list the range leases of the service
+func (s *Manager) ListLeases(serviceName string) ([]*RangeLease, error) {
+	leaser, err := s.rangeLeaser()
+	if err != nil {
+		return nil, err
+	}
+	return leaser.Leases(serviceName)
+}
+
+// LedgerEntries query the ledger entries of the ids allocation, the latest entries first.
+// the entries are recorded on Config.Ledger is enabled.
+func (s *Manager) LedgerEntries(q *LedgerQuery) ([]*LedgerEntry, error) {
+	ledger, ok := s.store.(Ledger)
+	if !ok {
+		return nil, fmt.Errorf("the storage %T not support the ledger", s.store)
+	}
+	return ledger.LedgerEntries(q)
+}
+
+func (s *Manager) rangeLeaser() (RangeLeaser, error) {
+	leaser, ok := s.store.(RangeLeaser)
+	if !ok {
+		return nil, fmt.Errorf("the storage %T not support lease range", s.store)
+	}
+	return leaser, nil
+}
+
+// NextString generate next id as string. the int64 id will be formatted as decimal.
+func (s *Manager) NextString(serviceName string) (string, error) {
+	gen, err := s.GetGenerator(serviceName)
+	if err != nil {
+		return "", err
+	}
+
+	if sg, ok := gen.(genid.StringGeneratorFace); ok {
+		return sg.NextString()
+	}
+
+	f, err := s.formatter(gen, "")
+	if err != nil {
+		return "", err
+	}
+
+	id, err := gen.Next()
+	if err != nil {
+		return "", err
+	}
+	return f.Format(id), nil
+}
+
+// NextFormatted generate next id, and format it by the template. see Template.
+// if tpl is empty, will use the service option Format, the id is formatted as decimal if both are empty.
+//
+// Usage:
+//	id, str, err := NextFormatted("service_invoice", "INV-{date:yyyyMMdd}-{seq:08}{luhn}")
+func (s *Manager) NextFormatted(serviceName, tpl string) (int64, string, error) {
+	gen, err := s.GetGenerator(serviceName)
+	if err != nil {
+		return 0, "", err
+	}
+
+	f, err := s.formatter(gen, tpl)
+	if err != nil {
+		return 0, "", err
+	}
+
+	id, err := gen.Next()
+	if err != nil {
+		return 0, "", err
+	}
+	return id, f.Format(id), nil
+}
+
+// NextFormattedN generate n ids, and format them by the template. see NextFormatted
+func (s *Manager) NextFormattedN(serviceName, tpl string, n int) ([]int64, []string, error) {
+	gen, err := s.GetGenerator(serviceName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := s.formatter(gen, tpl)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids, err := s.NextIds(serviceName, n)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = f.Format(id)
+	}
+	return ids, strs, nil
+}
+
+// the formatter of the int64 ids
+type formatter struct {
+	tpl *Template
+	loc *time.Location
+}
+
+// Format the id by the template, or as decimal if no template
+func (f *formatter) Format(id int64) string {
+	if f.tpl == nil {
+		return strconv.FormatInt(id, 10)
+	}
+	return f.tpl.Format(id, time.Now().In(f.loc))
+}
+
+// get the formatter by the template, if tpl is empty, use the service option Format.
+// the formatters of the service options are cached.
+func (s *Manager) formatter(gen ServiceGenerator, tpl string) (*formatter, error) {
+	opts := gen.Options()
+	if tpl != "" && tpl != opts.Format {
+		// the template of the request, not cached
+		t, err := ParseTemplate(tpl)
+		if err != nil {
+			return nil, err
+		}
+		return &formatter{tpl: t, loc: opts.Location()}, nil
+	}
+
+	if opts.Format == "" {
+		return &formatter{}, nil
+	}
+
+	key := opts.TZ + "|" + opts.Format
+	s.fmtLock.Lock()
+	defer s.fmtLock.Unlock()
+
+	if f, ok := s.formatters[key]; ok {
+		return f, nil
+	}
+
+	t, err := ParseTemplate(opts.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.formatters == nil {
+		s.formatters = make(map[string]*formatter)
+	}
+
+	f := &formatter{tpl: t, loc: opts.Location()}
+	s.formatters[key] = f
+	return f, nil
+}
+
+// CurrentString get current id as string
+func (s *Manager) CurrentString(serviceName string) (string, error) {
+	gen, err := s.GetGenerator(serviceName)
+	if err != nil {
+		return "", err
+	}
+
+	if sg, ok := gen.(genid.StringGeneratorFace); ok {
+		return sg.CurrentString(), nil
+	}
+
+	f, err := s.formatter(gen, "")
+	if err != nil {
+		return "", err
+	}
+	return f.Format(gen.Current()), nil
+}
+
+// NextEncoded generate next id, and encode it to the short reversible string by the service options
+// Salt, Alphabet and MinLength. the encoded id can be decoded by DecodeId.
+func (s *Manager) NextEncoded(serviceName string) (int64, string, error) {
+	gen, err := s.GetGenerator(serviceName)
+	if err != nil {
+		return 0, "", err
+	}
+
+	enc, err := s.encoder(gen)
+	if err != nil {
+		return 0, "", err
+	}
+
+	id, err := gen.Next()
+	if err != nil {
+		return 0, "", err
+	}
+
+	str, err := enc.Encode(id)
+	return id, str, err
+}
+
+// NextEncodedN generate n ids, and encode them. see NextEncoded
+func (s *Manager) NextEncodedN(serviceName string, n int) ([]int64, []string, error) {
+	gen, err := s.GetGenerator(serviceName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	enc, err := s.encoder(gen)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids, err := s.NextIds(serviceName, n)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		if strs[i], err = enc.Encode(id); err != nil {
+			return nil, nil, err
+		}
+	}
+	return ids, strs, nil
+}
+
+// DecodeId decode the encoded id of the service to the int64 id.
+// returns hashid.ErrInvalidHash if it's not encoded by the service.
+func (s *Manager) DecodeId(serviceName, str string) (int64, error) {
+	gen, err := s.GetGenerator(serviceName)
+	if err != nil {
+		return 0, err
+	}
+
+	enc, err := s.encoder(gen)
+	if err != nil {
+		return 0, err
+	}
+	return enc.Decode(str)
+}
+
+// get the id encoder by the service options, the encoders are cached.
+func (s *Manager) encoder(gen ServiceGenerator) (*hashid.Encoder, error) {
+	if _, ok := gen.(genid.StringGeneratorFace); ok {
+		return nil, fmt.Errorf("the service %s generates the string ids, can not encode", gen.Name())
+	}
+
+	opts := gen.Options()
+	key := opts.Salt + "|" + opts.Alphabet + "|" + strconv.FormatInt(opts.MinLength, 10)
+
+	s.fmtLock.Lock()
+	defer s.fmtLock.Unlock()
+
+	if enc, ok := s.encoders[key]; ok {
+		return enc, nil
+	}
+
+	enc, err := opts.Encoder()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.encoders == nil {
+		s.encoders = make(map[string]*hashid.Encoder)
+	}
+	s.encoders[key] = enc
+	return enc, nil
+}
+
+// IsStringService check the service generates the string ids, the formatted int64 ids are not included.
+func (s *Manager) IsStringService(serviceName string) bool {
+	gen, err := s.GetGenerator(serviceName)
+	if err != nil {
+		return false
+	}
+
+	_, ok := gen.(genid.StringGeneratorFace)
+	return ok
+}
+
 // std the default manager
 var std = NewEmptyManager()
 
@@ -376,8 +897,8 @@ func Std() *Manager {
 }
 
 // InitStdManager init the default manager
-func InitStdManager(db *sql.DB) error {
-	std.db = db
+func InitStdManager(store Storage) error {
+	std.store = store
 	return std.Init()
 }
 
@@ -385,7 +906,7 @@ func InitStdManager(db *sql.DB) error {
 func ListServices() map[string]int64 { return std.ListServices() }
 
 // GetGenerator list all exists services
-func GetGenerator(serviceName string) (*Generator, error) { return std.GetGenerator(serviceName) }
+func GetGenerator(serviceName string) (ServiceGenerator, error) { return std.GetGenerator(serviceName) }
 
 // ServiceExists check service exists
 func ServiceExists(serviceName string) bool { return std.ServiceExists(serviceName) }
@@ -393,6 +914,26 @@ func ServiceExists(serviceName string) bool { return std.ServiceExists(serviceNa
 // NextId generate next id
 func NextId(serviceName string) (int64, error) { return std.NextId(serviceName) }
 
+// IncrBy reserve n contiguous ids of the service, returns the last id
+func IncrBy(serviceName string, n int64) (int64, error) { return std.IncrBy(serviceName, n) }
+
+// NextIds generate n ids of the service
+func NextIds(serviceName string, n int) ([]int64, error) { return std.NextIds(serviceName, n) }
+
+// NextString generate next id as string
+func NextString(serviceName string) (string, error) { return std.NextString(serviceName) }
+
+// NextFormatted generate next id, and format it by the template
+func NextFormatted(serviceName, tpl string) (int64, string, error) {
+	return std.NextFormatted(serviceName, tpl)
+}
+
+// NextEncoded generate next id, and encode it
+func NextEncoded(serviceName string) (int64, string, error) { return std.NextEncoded(serviceName) }
+
+// DecodeId decode the encoded id of the service
+func DecodeId(serviceName, str string) (int64, error) { return std.DecodeId(serviceName, str) }
+
 // CurrentId get current id
 func CurrentId(serviceName string) (int64, error) { return std.CurrentId(serviceName) }
 
@@ -401,6 +942,27 @@ func SetServiceId(serviceName string, lastId int64, force bool) (int64, error) {
 	return std.SetServiceId(serviceName, lastId, force)
 }
 
+// SetServiceBatch set the batch count of the service
+func SetServiceBatch(serviceName string, batch int64) error {
+	return std.SetServiceBatch(serviceName, batch)
+}
+
+// SetServiceOptions set options for the service
+func SetServiceOptions(serviceName string, kvMap map[string]string) error {
+	return std.SetServiceOptions(serviceName, kvMap)
+}
+
+// check the key is a bucket key of any scoped service. scopes is the map of the service name to the scope.
+func isAnyBucketKey(key string, scopes map[string]string) bool {
+	i := strings.LastIndex(key, ScopedSep)
+	if i <= 0 {
+		return false
+	}
+
+	scope, ok := scopes[key[:i]]
+	return ok && isBucketKey(key, key[:i], scope)
+}
+
 // GoodServiceKey check input service name key is valid
 func GoodServiceKey(serviceName string) (string, error) {
 	serviceName = strings.TrimSpace(serviceName)
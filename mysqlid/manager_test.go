@@ -0,0 +1,559 @@
+package mysqlid_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/inherelab/genid/mysqlid"
+)
+
+func TestManager_serviceType(t *testing.T) {
+	mgr := mysqlid.NewManager(mysqlid.NewMemoryStorage())
+	if err := mgr.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	name := "sf_order"
+	if _, err := mgr.SetServiceId(name, 100, false); err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := mgr.NextId(name); id != 101 {
+		t.Fatalf("the segment service next id should be 101, but got %d", id)
+	}
+
+	// the type of the existing service can not be changed, other nodes may serve it by the cached generator
+	err := mgr.SetServiceOptions(name, map[string]string{"type": "snowflake"})
+	if err != mysqlid.ErrTypeChanged {
+		t.Fatalf("should returns ErrTypeChanged, but got %v", err)
+	}
+	if _, err = mgr.SetService(name, 0, true, map[string]string{"type": "snowflake"}); err != mysqlid.ErrTypeChanged {
+		t.Fatalf("should returns ErrTypeChanged, but got %v", err)
+	}
+
+	name = "sf_user"
+	if _, err = mgr.SetService(name, 0, false, map[string]string{"type": "snowflake"}); err != nil {
+		t.Fatal(err)
+	}
+
+	gen, err := mgr.GetGenerator(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := gen.(*mysqlid.SnowflakeService); !ok {
+		t.Fatalf("the service generator should be snowflake, but got %T", gen)
+	}
+
+	id1, _ := mgr.NextId(name)
+	id2, err := mgr.NextId(name)
+	if err != nil || id2 <= id1 || id1 < 1<<22 {
+		t.Fatalf("invalid snowflake ids %d %d, err: %v", id1, id2, err)
+	}
+
+	// the service type is saved to the storage
+	mgr = mysqlid.NewManager(mgr.Storage())
+	if err = mgr.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if gen, _ = mgr.GetGenerator(name); gen.Options().Type != mysqlid.TypeSnowflake {
+		t.Fatalf("the service type should be snowflake after restart, got %T", gen)
+	}
+
+	if err = mgr.SetServiceOptions(name, map[string]string{"type": "unknown"}); err == nil {
+		t.Fatal("should returns error on unknown service type")
+	}
+}
+
+func TestManager_workerLease(t *testing.T) {
+	c := mysqlid.NewConfig()
+	c.Snowflake.WorkerLease = true
+	mysqlid.SetConfig(c)
+	defer mysqlid.SetConfig(mysqlid.NewConfig())
+
+	store := mysqlid.NewMemoryStorage()
+	mgr1 := mysqlid.NewManager(store)
+	mgr2 := mysqlid.NewManager(store)
+	if err := mgr1.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr2.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	if mgr1.WorkerId() != 0 || mgr2.WorkerId() != 1 {
+		t.Fatalf("the leased worker ids should be 0 and 1, but got %d and %d", mgr1.WorkerId(), mgr2.WorkerId())
+	}
+
+	// the snowflake service use the leased worker id
+	if _, err := mgr2.SetService("sf_user", 0, false, map[string]string{"type": "snowflake"}); err != nil {
+		t.Fatal(err)
+	}
+
+	gen, _ := mgr2.GetGenerator("sf_user")
+	id, err := gen.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, workerId, _ := gen.(*mysqlid.SnowflakeService).Decode(id); workerId != 1 {
+		t.Fatalf("the worker id of the id should be 1, but got %d", workerId)
+	}
+
+	// the released worker id can be leased again
+	if err = mgr1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	mgr3 := mysqlid.NewManager(store)
+	if err = mgr3.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if mgr3.WorkerId() != 0 {
+		t.Fatalf("the released worker id 0 should be leased again, but got %d", mgr3.WorkerId())
+	}
+
+	mgr2.Close()
+	mgr3.Close()
+	if _, err = gen.Next(); err != mysqlid.ErrLeaseLost {
+		t.Fatalf("should returns ErrLeaseLost after closed, but got %v", err)
+	}
+}
+
+func TestManager_workerLeaseLost(t *testing.T) {
+	c := mysqlid.NewConfig()
+	c.Snowflake.WorkerLease = true
+	mysqlid.SetConfig(c)
+	defer mysqlid.SetConfig(mysqlid.NewConfig())
+
+	store := mysqlid.NewMemoryStorage()
+	mgr1 := mysqlid.NewManager(store)
+	if err := mgr1.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer mgr1.Close()
+
+	if _, err := mgr1.SetService("sf_user", 0, false, map[string]string{"type": "snowflake"}); err != nil {
+		t.Fatal(err)
+	}
+	gen, _ := mgr1.GetGenerator("sf_user")
+	sg := gen.(*mysqlid.SnowflakeService)
+
+	// the lease of mgr1 is expired, and the worker id 0 is reclaimed by mgr2
+	mysqlid.ExpireWorker(store, 0)
+	mgr2 := mysqlid.NewManager(store)
+	if err := mgr2.Init(); err != nil {
+		t.Fatal(err)
+	}
+	defer mgr2.Close()
+
+	if mgr2.WorkerId() != 0 {
+		t.Fatalf("the expired worker id 0 should be reclaimed, but got %d", mgr2.WorkerId())
+	}
+
+	// mgr1 leases a new worker id, instead of renewing the worker id of mgr2
+	if err := mysqlid.RenewLease(mgr1); err != nil {
+		t.Fatal(err)
+	}
+	if mgr1.WorkerId() != 1 {
+		t.Fatalf("the new worker id 1 should be leased, but got %d", mgr1.WorkerId())
+	}
+
+	id, err := sg.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, workerId, _ := sg.Decode(id); workerId != 1 {
+		t.Fatalf("the worker id of the id should be 1, but got %d", workerId)
+	}
+
+	// the lease of mgr2 is not taken
+	if err = mysqlid.RenewLease(mgr2); err != nil || mgr2.WorkerId() != 0 {
+		t.Fatalf("the worker id of mgr2 should be kept 0, but got %d, err: %v", mgr2.WorkerId(), err)
+	}
+}
+
+func TestManager_stringService(t *testing.T) {
+	mgr := mysqlid.NewManager(mysqlid.NewMemoryStorage())
+	if err := mgr.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, typ := range []string{mysqlid.TypeULID, mysqlid.TypeUUIDv7} {
+		if _, err := mgr.SetService(typ, 0, false, map[string]string{"type": typ}); err != nil {
+			t.Fatal(err)
+		}
+		if !mgr.IsStringService(typ) {
+			t.Fatalf("the %s service should generate the string ids", typ)
+		}
+
+		id1, _ := mgr.NextString(typ)
+		id2, err := mgr.NextString(typ)
+		if err != nil || id2 <= id1 {
+			t.Fatalf("invalid %s ids %s %s, err: %v", typ, id1, id2, err)
+		}
+		if cur, _ := mgr.CurrentString(typ); cur != id2 {
+			t.Fatalf("the current %s id should be %s, but got %s", typ, id2, cur)
+		}
+		if _, err = mgr.NextId(typ); err != mysqlid.ErrStringService {
+			t.Fatalf("NextId should returns ErrStringService, but got %v", err)
+		}
+	}
+}
+
+func TestManager_LeaseRange(t *testing.T) {
+	mgr := mysqlid.NewManager(mysqlid.NewMemoryStorage())
+	if err := mgr.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	name := "lease_order"
+	if _, err := mgr.SetServiceId(name, 100, false); err != nil {
+		t.Fatal(err)
+	}
+	id, _ := mgr.NextId(name)
+
+	lease, err := mgr.LeaseRange(name, "importer", 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lease.Start <= id || lease.Size() != 5000 || lease.Client != "importer" {
+		t.Fatalf("invalid lease range: %+v", lease)
+	}
+
+	// the ids of the service will not overlap the leased range
+	ids, err := mgr.NextIds(name, 3000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range ids {
+		if id >= lease.Start && id <= lease.End {
+			t.Fatalf("the id %d is in the leased range [%d, %d]", id, lease.Start, lease.End)
+		}
+	}
+
+	if err = mgr.ReportLease(lease.Id, 1200); err != nil {
+		t.Fatal(err)
+	}
+	if err = mgr.ReportLease(lease.Id+100, 1); err != mysqlid.ErrLeaseNotExists {
+		t.Fatalf("should returns ErrLeaseNotExists, but got %v", err)
+	}
+
+	leases, err := mgr.ListLeases(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leases) != 1 || leases[0].Used != 1200 || leases[0].ReportedAt.IsZero() {
+		t.Fatalf("invalid leases: %+v", leases)
+	}
+}
+
+func TestManager_stepOffset(t *testing.T) {
+	for _, offset := range []int64{1, 2} {
+		mgr := mysqlid.NewManager(mysqlid.NewMemoryStorage())
+		if err := mgr.Init(); err != nil {
+			t.Fatal(err)
+		}
+
+		name := "step_order"
+		if _, err := mgr.SetServiceId(name, 0, false); err != nil {
+			t.Fatal(err)
+		}
+		err := mgr.SetServiceOptions(name, map[string]string{"batch": "10", "step": "2", "offset": strconv.FormatInt(offset, 10)})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		check := func(ids ...int64) {
+			for _, id := range ids {
+				if id%2 != offset%2 {
+					t.Fatalf("the id %d is not matched the step 2 and offset %d", id, offset)
+				}
+			}
+		}
+
+		first, _ := mgr.NextId(name)
+		if first != offset {
+			t.Fatalf("the first id should be %d, but got %d", offset, first)
+		}
+
+		// cross the segments
+		ids, err := mgr.NextIds(name, 25)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(ids...)
+		if ids[0] != first+2 || ids[24] != first+50 {
+			t.Fatalf("the ids should be continuous on the step, got %v", ids)
+		}
+
+		// reset to 1000, the next id is aligned
+		if _, err = mgr.SetServiceId(name, 1000, true); err != nil {
+			t.Fatal(err)
+		}
+		id, _ := mgr.NextId(name)
+		check(id)
+		if id != 1000+offset {
+			t.Fatalf("the next id after reset should be %d, but got %d", 1000+offset, id)
+		}
+
+		lease, err := mgr.LeaseRange(name, "", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check(lease.Start, lease.End)
+		if lease.Step != 2 || lease.Size() != 10 {
+			t.Fatalf("invalid lease range: %+v", lease)
+		}
+	}
+
+	mgr := mysqlid.NewManager(mysqlid.NewMemoryStorage())
+	mgr.Init()
+	mgr.SetServiceId("bad_step", 0, false)
+	if err := mgr.SetServiceOptions("bad_step", map[string]string{"step": "2", "offset": "3"}); err == nil {
+		t.Fatal("should returns error on the offset is greater than the step")
+	}
+}
+
+func TestManager_maxId(t *testing.T) {
+	var alerts []float64
+	defaultAlert := mysqlid.OnExhaustAlert
+	defer func() { mysqlid.OnExhaustAlert = defaultAlert }()
+
+	mysqlid.OnExhaustAlert = func(name string, id, maxId int64, threshold float64) {
+		alerts = append(alerts, threshold)
+	}
+
+	store := mysqlid.NewMemoryStorage()
+	mgr := mysqlid.NewManager(store)
+	if err := mgr.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	name := "max_order"
+	if _, err := mgr.SetServiceId(name, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	err := mgr.SetServiceOptions(name, map[string]string{"batch": "3", "max_id": "20"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err := mgr.NextIds(name, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids[19] != 20 {
+		t.Fatalf("the last id should be 20, but got %d", ids[19])
+	}
+	if len(alerts) != 2 || alerts[0] != 0.8 || alerts[1] != 0.95 {
+		t.Fatalf("should alert on 80%% and 95%% of the max_id, got %v", alerts)
+	}
+
+	cur, _ := store.Current(name)
+	if _, err = mgr.NextId(name); err != mysqlid.ErrIdExhausted {
+		t.Fatalf("should returns ErrIdExhausted, but got %v", err)
+	}
+	if _, err = mgr.LeaseRange(name, "", 10); err != mysqlid.ErrIdExhausted {
+		t.Fatalf("lease range should returns ErrIdExhausted, but got %v", err)
+	}
+	// the counter should not be moved on exhausted
+	if id, _ := store.Current(name); id != cur {
+		t.Fatalf("the storage id should be kept %d, but got %d", cur, id)
+	}
+
+	// wrap to the min_id
+	err = mgr.SetServiceOptions(name, map[string]string{"exhausted": "wrap", "min_id": "5"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := mgr.NextId(name); err != nil || id != 5 {
+		t.Fatalf("the id should be wrapped to 5, but got %d, err: %v", id, err)
+	}
+
+	// the lease range is wrapped by the exhausted policy too
+	lease, err := mgr.LeaseRange(name, "", 10)
+	if err != nil || lease.Start != 8 || lease.End != 17 {
+		t.Fatalf("the lease range should be [8, 17], got %+v, err: %v", lease, err)
+	}
+	lease, err = mgr.LeaseRange(name, "", 10)
+	if err != nil || lease.Start != 5 || lease.End != 14 {
+		t.Fatalf("the lease range should be wrapped to [5, 14], got %+v, err: %v", lease, err)
+	}
+
+	if err = mgr.SetServiceOptions(name, map[string]string{"exhausted": "unknown"}); err == nil {
+		t.Fatal("should returns error on unknown exhausted policy")
+	}
+	if err = mgr.SetServiceOptions(name, map[string]string{"alerts": "0.5,1.2"}); err == nil {
+		t.Fatal("should returns error on invalid alerts")
+	}
+}
+
+func TestManager_scoped(t *testing.T) {
+	store := mysqlid.NewMemoryStorage()
+	mgr := mysqlid.NewManager(store)
+	if err := mgr.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	name := "order_no"
+	_, err := mgr.SetService(name, 0, false, map[string]string{"scope": "day", "tz": "UTC", "keep": "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the ordinary service named like the bucket key is not a bucket
+	other := name + mysqlid.ScopedSep + "foo"
+	if _, err := mgr.SetServiceId(other, 0, false); err != nil {
+		t.Fatal(err)
+	}
+
+	gen, _ := mgr.GetGenerator(name)
+	sg, ok := gen.(*mysqlid.ScopedService)
+	if !ok {
+		t.Fatalf("the service generator should be scoped, but got %T", gen)
+	}
+
+	now := time.Date(2026, 10, 18, 23, 59, 0, 0, time.UTC)
+	mysqlid.SetScopedClock(sg, func() time.Time { return now })
+
+	if id, err := mgr.NextString(name); err != nil || id != "20261018-000001" {
+		t.Fatalf("the id should be 20261018-000001, but got %s, err: %v", id, err)
+	}
+	ids, err := mgr.NextStrings(name, 2)
+	if err != nil || ids[1] != "20261018-000003" {
+		t.Fatalf("invalid ids %v, err: %v", ids, err)
+	}
+	if !mgr.IsStringService(name) {
+		t.Fatal("the scoped service should generate the string ids")
+	}
+
+	// the counter is reset on the next day
+	for day := 19; day <= 21; day++ {
+		now = time.Date(2026, 10, day, 0, 0, 1, 0, time.UTC)
+		want := "202610" + strconv.Itoa(day) + "-000001"
+		if id, err := mgr.NextString(name); err != nil || id != want {
+			t.Fatalf("the id should be %s, but got %s, err: %v", want, id, err)
+		}
+	}
+
+	// the old buckets are deleted, and the buckets are not loaded as services
+	if ok, _ = store.Exists(name + mysqlid.ScopedSep + "20261019"); ok {
+		t.Fatal("the old bucket should be deleted")
+	}
+	if ok, _ = store.Exists(name + mysqlid.ScopedSep + "20261020"); !ok {
+		t.Fatal("the kept bucket should exists")
+	}
+	if ok, _ = store.Exists(other); !ok {
+		t.Fatal("the ordinary service should not be deleted as the old bucket")
+	}
+
+	mgr = mysqlid.NewManager(store)
+	if err = mgr.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if services := mgr.ListServices(); len(services) != 2 {
+		t.Fatalf("should only load the scoped service and the ordinary service, got %v", services)
+	}
+
+	if err = mgr.DelService(name); err != nil {
+		t.Fatal(err)
+	}
+	if keys, _ := store.Keys(); len(keys) != 1 || keys[0] != other {
+		t.Fatalf("the buckets should be deleted with the service, got %v", keys)
+	}
+
+	if err = new(mysqlid.Options).Set("scope", "week"); err == nil {
+		t.Fatal("should returns error on unknown scope")
+	}
+}
+
+func TestManager_encode(t *testing.T) {
+	mgr := mysqlid.NewManager(mysqlid.NewMemoryStorage())
+	if err := mgr.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	name := "public_order"
+	if _, err := mgr.SetServiceId(name, 100, false); err != nil {
+		t.Fatal(err)
+	}
+	err := mgr.SetServiceOptions(name, map[string]string{"salt": "s3cret", "min_length": "8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, str, err := mgr.NextEncoded(name)
+	if err != nil || id != 101 || len(str) < 8 {
+		t.Fatalf("invalid encoded id %d %s, err: %v", id, str, err)
+	}
+	if got, err := mgr.DecodeId(name, str); err != nil || got != id {
+		t.Fatalf("decode %s should be %d, but got %d, err: %v", str, id, got, err)
+	}
+
+	// the encoded ids are changed by the salt
+	if err = mgr.SetServiceOptions(name, map[string]string{"salt": "other"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = mgr.DecodeId(name, str); err == nil {
+		t.Fatal("should returns error on decode by the other salt")
+	}
+
+	if err = mgr.SetServiceOptions(name, map[string]string{"alphabet": "abc"}); err == nil {
+		t.Fatal("should returns error on the short alphabet")
+	}
+}
+
+func TestManager_ledger(t *testing.T) {
+	c := mysqlid.NewConfig()
+	c.Ledger = true
+	c.NodeName = "node-1"
+	c.DoubleBuffer = false
+	mysqlid.SetConfig(c)
+	defer mysqlid.SetConfig(mysqlid.NewConfig())
+
+	mgr := mysqlid.NewManager(mysqlid.NewMemoryStorage())
+	if err := mgr.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	name := "ledger_order"
+	if _, err := mgr.SetServiceId(name, 100, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.SetServiceBatch(name, 10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mgr.NextIds(name, 15); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mgr.LeaseRange(name, "importer", 5); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := mgr.LedgerEntries(&mysqlid.LedgerQuery{Key: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the latest entries first
+	want := []string{"lease:121-125", "alloc:111-120", "alloc:101-110", "reset:100-100"}
+	if len(entries) != len(want) {
+		t.Fatalf("should has %d entries, but got %d", len(want), len(entries))
+	}
+	for i, e := range entries {
+		got := e.Reason + ":" + strconv.FormatInt(e.Start, 10) + "-" + strconv.FormatInt(e.End, 10)
+		if got != want[i] || e.Node != "node-1" {
+			t.Fatalf("the entry %d should be %s on node-1, but got %s on %s", i, want[i], got, e.Node)
+		}
+	}
+
+	// find the allocation of an id
+	entries, _ = mgr.LedgerEntries(&mysqlid.LedgerQuery{IdIn: 115})
+	if len(entries) != 1 || entries[0].Start != 111 {
+		t.Fatalf("should find the allocation of id 115, got %v", entries)
+	}
+
+	// the storage not support the ledger
+	mgr = mysqlid.NewManager(struct{ mysqlid.Storage }{mysqlid.NewMemoryStorage()})
+	if err = mgr.Init(); err == nil {
+		t.Fatal("should returns error on the storage not support the ledger")
+	}
+}
@@ -0,0 +1,204 @@
+package mysqlid
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// the state of a key on the memory storage
+type memoryKey struct {
+	id   int64
+	opts Options
+}
+
+// MemoryStorage the in-memory storage. the ids will be lost on the process exit,
+// it's useful for testing and the development.
+type MemoryStorage struct {
+	memoryLeases
+	memoryLedger
+
+	lock sync.Mutex
+	keys map[string]*memoryKey
+	// the worker id leases
+	workers map[int64]*memoryWorker
+}
+
+type memoryWorker struct {
+	node     string
+	expireAt time.Time
+}
+
+// NewMemoryStorage instance
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		keys:    make(map[string]*memoryKey),
+		workers: make(map[int64]*memoryWorker),
+	}
+}
+
+// Init the storage. nothing to do
+func (s *MemoryStorage) Init() error {
+	return nil
+}
+
+// Keys list all service keys
+func (s *MemoryStorage) Keys() ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	keys := make([]string, 0, len(s.keys))
+	for key := range s.keys {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Exists check the key is exists
+func (s *MemoryStorage) Exists(key string) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, ok := s.keys[key]
+	return ok, nil
+}
+
+// Current get the current max id of the key
+func (s *MemoryStorage) Current(key string) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if k, ok := s.keys[key]; ok {
+		return k.id, nil
+	}
+	return 0, nil
+}
+
+// Alloc allocate an id range of size for the key
+func (s *MemoryStorage) Alloc(key string, size int64) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	k, ok := s.keys[key]
+	if !ok {
+		return 0, fmt.Errorf("%s: have no id name", key)
+	}
+
+	start := k.id
+	k.id += size
+	return start, nil
+}
+
+// Wrap reset the key id to id, only if the current id is not less than the threshold
+func (s *MemoryStorage) Wrap(key string, threshold, id int64) (int64, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	k, ok := s.keys[key]
+	if !ok {
+		return 0, false, fmt.Errorf("%s: have no id name", key)
+	}
+
+	if k.id < threshold {
+		return k.id, false, nil
+	}
+
+	k.id = id
+	return id, true, nil
+}
+
+// Reset the key id. if the key exists and force=false, will not change the id.
+func (s *MemoryStorage) Reset(key string, idOffset int64, force bool) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	k, ok := s.keys[key]
+	if !ok {
+		s.keys[key] = &memoryKey{id: idOffset}
+		return idOffset, nil
+	}
+
+	// NOTICE: dont update id value to `idOffset`.
+	if force {
+		k.id = idOffset
+	}
+	return k.id, nil
+}
+
+// Delete the key
+func (s *MemoryStorage) Delete(key string) error {
+	s.lock.Lock()
+	delete(s.keys, key)
+	s.lock.Unlock()
+	return nil
+}
+
+// Options get a copy of the service options of the key
+func (s *MemoryStorage) Options(key string) (*Options, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	opts := &Options{}
+	if k, ok := s.keys[key]; ok {
+		*opts = k.opts
+	}
+	return opts, nil
+}
+
+// SaveOptions save the service options of the key
+func (s *MemoryStorage) SaveOptions(key string, opts *Options) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	k, ok := s.keys[key]
+	if !ok {
+		return ErrKeyNotExists
+	}
+
+	k.opts = *opts
+	return nil
+}
+
+// LeaseWorker lease a free or expired worker id in 0 ~ max for the node
+func (s *MemoryStorage) LeaseWorker(node string, max int64, ttl time.Duration) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	for workerId := int64(0); workerId <= max; workerId++ {
+		w, ok := s.workers[workerId]
+		if !ok || w.expireAt.Before(now) {
+			s.workers[workerId] = &memoryWorker{node: node, expireAt: now.Add(ttl)}
+			return workerId, nil
+		}
+	}
+	return 0, fmt.Errorf("no free worker id in 0 ~ %d", max)
+}
+
+// RenewWorker renew the lease of the worker id
+func (s *MemoryStorage) RenewWorker(workerId int64, node string, ttl time.Duration) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	w, ok := s.workers[workerId]
+	if !ok || w.node != node {
+		return ErrLeaseLost
+	}
+
+	w.expireAt = time.Now().Add(ttl)
+	return nil
+}
+
+// ReleaseWorker release the worker id
+func (s *MemoryStorage) ReleaseWorker(workerId int64, node string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if w, ok := s.workers[workerId]; ok && w.node == node {
+		delete(s.workers, workerId)
+	}
+	return nil
+}
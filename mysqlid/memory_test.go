@@ -0,0 +1,17 @@
+package mysqlid_test
+
+import (
+	"testing"
+
+	"github.com/inherelab/genid/idtest"
+	"github.com/inherelab/genid/mysqlid"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	// the generators restart on the same storage
+	store := mysqlid.NewMemoryStorage()
+
+	idtest.RunStorage(t, func(t *testing.T) mysqlid.Storage {
+		return store
+	})
+}
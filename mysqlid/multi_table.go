@@ -1 +1,413 @@
 package mysqlid
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/gookit/slog"
+)
+
+// on multi table mode, create one table for each service,
+// and record all services on the manager table(Config.TableName).
+const (
+	ManagerTableName = "_idgen_manager"
+
+	// create name table
+	CreateTableSQLFormat = `
+CREATE TABLE %s (
+    id bigint(20) unsigned NOT NULL auto_increment,
+    PRIMARY KEY  (id)
+) ENGINE=Innodb DEFAULT CHARSET=utf8`
+
+	// create name table if not exist
+	CreateTableNTSQLFormat = `
+CREATE TABLE IF NOT EXISTS %s (
+    id bigint(20) unsigned NOT NULL auto_increment,
+    PRIMARY KEY  (id)
+) ENGINE=Innodb DEFAULT CHARSET=utf8`
+
+	DropTableSQLFormat   = `DROP TABLE IF EXISTS %s`
+	InsertIdSQLFormat    = "INSERT INTO %s(`id`) VALUES(%d)"
+	SelectIdSQLFormat    = "SELECT `id` FROM `%s`"
+	SelectForUpdate      = "SELECT `id` FROM %s FOR UPDATE"
+	UpdateIdSQLFormat    = "UPDATE `%s` SET `id` = `id` + %d"
+	WrapIdSQLFormat      = "UPDATE `%s` SET `id` = ? WHERE `id` >= ?"
+	GetRowCountSQLFormat = "SELECT count(*) FROM `%s`"
+	// SHOW TABLES LIKE '%service_user%';
+	// SHOW TABLES WHERE Tables_in_{DB_NAME} = 'service_user';
+	GetKeySQLFormat = "SHOW TABLES LIKE '%s'"
+
+	CreateRecordTableSQLFormat = `
+CREATE TABLE %s (
+	k VARCHAR(255) NOT NULL COMMENT 'service name',
+	options VARCHAR(2048) NOT NULL DEFAULT '' COMMENT 'service options, json',
+	PRIMARY KEY (k)
+) ENGINE=Innodb DEFAULT CHARSET=utf8`
+
+	// create name table if not exist
+	CreateRecordTableNTSQLFormat = `
+CREATE TABLE IF NOT EXISTS %s (
+	k VARCHAR(255) NOT NULL COMMENT 'service name',
+	options VARCHAR(2048) NOT NULL DEFAULT '' COMMENT 'service options, json',
+	PRIMARY KEY (k)
+) ENGINE=Innodb DEFAULT CHARSET=utf8`
+
+	// upgrade the manager table created by old version
+	GetOptionsColumnSQLFormat = "SHOW COLUMNS FROM `%s` LIKE 'options'"
+	AddOptionsColumnSQLFormat = "ALTER TABLE `%s` ADD COLUMN `options` VARCHAR(2048) NOT NULL DEFAULT '' COMMENT 'service options, json'"
+
+	InsertKeySQLFormat  = "INSERT INTO `%s` (`k`) VALUES (?)"
+	SelectKeySQLFormat  = "SELECT `k` FROM `%s` WHERE `k` = ?"
+	SelectKeysSQLFormat = "SELECT `k` FROM `%s`"
+	DeleteKeySQLFormat  = "DELETE FROM `%s` WHERE `k` = ?"
+)
+
+// MultiTableStorage the MySQL storage on multi table mode
+type MultiTableStorage struct {
+	mysqlTable
+	// the prefix of service id table name
+	prefix string
+
+	// the resolved id table names of the keys
+	tableLock sync.Mutex
+	tables    map[string]string
+}
+
+// NewMultiTableStorage instance
+func NewMultiTableStorage(db *sql.DB, managerTable, prefix string) *MultiTableStorage {
+	return &MultiTableStorage{
+		mysqlTable: mysqlTable{db: db, table: managerTable},
+		prefix:     prefix,
+		tables:     make(map[string]string),
+	}
+}
+
+// KeyTable get the id table name of the key.
+// NOTICE: the tables created before the prefix is set are named by the bare key, see keyTable.
+func (s *MultiTableStorage) KeyTable(key string) string {
+	table, err := s.keyTable(key)
+	if err != nil {
+		slog.Errorf("%s: resolve the id table error: %s", key, err.Error())
+		return s.prefix + key
+	}
+	return table
+}
+
+// resolve the id table of the key. it's the prefix + key, but if the prefixed table not exists and the table
+// named by the bare key exists, use the legacy table. so the services are kept on upgrade with a table_prefix.
+func (s *MultiTableStorage) keyTable(key string) (string, error) {
+	if s.prefix == "" {
+		return key, nil
+	}
+
+	s.tableLock.Lock()
+	defer s.tableLock.Unlock()
+
+	if table, ok := s.tables[key]; ok {
+		return table, nil
+	}
+
+	table := s.prefix + key
+	isExist, err := s.TableExist(table)
+	if err != nil {
+		return "", err
+	}
+
+	if !isExist {
+		legacyExist, err := s.TableExist(key)
+		if err != nil {
+			return "", err
+		}
+		if legacyExist {
+			slog.Warnf("%s: the id table %s not exists, use the legacy table %s", key, table, key)
+			table = key
+		}
+	}
+
+	s.tables[key] = table
+	return table, nil
+}
+
+// forget the resolved id table of the key, on the table is dropped
+func (s *MultiTableStorage) forgetTable(key string) {
+	s.tableLock.Lock()
+	delete(s.tables, key)
+	s.tableLock.Unlock()
+}
+
+// Init create the manager table.
+// NOTICE: the old version always use the manager table ManagerTableName, if the table_name not exists
+// and the legacy table exists, use the legacy table. so the services are kept on upgrade.
+func (s *MultiTableStorage) Init() error {
+	if err := s.useLegacyTable(); err != nil {
+		return err
+	}
+
+	createTableNtSQL := fmt.Sprintf(CreateRecordTableNTSQLFormat, s.table)
+
+	slog.Infof("SQL=%s", createTableNtSQL)
+	_, err := s.db.Exec(createTableNtSQL)
+	if err != nil {
+		return err
+	}
+
+	return s.upgradeTable()
+}
+
+// use the legacy manager table ManagerTableName, if the configured table not exists
+func (s *MultiTableStorage) useLegacyTable() error {
+	if s.table == ManagerTableName {
+		return nil
+	}
+
+	isExist, err := s.TableExist(s.table)
+	if err != nil || isExist {
+		return err
+	}
+
+	legacyExist, err := s.TableExist(ManagerTableName)
+	if err != nil {
+		return err
+	}
+	if legacyExist {
+		slog.Warnf("the manager table %s not exists, use the legacy table %s", s.table, ManagerTableName)
+		s.table = ManagerTableName
+	}
+	return nil
+}
+
+// add the options column for the manager table created by old version
+func (s *MultiTableStorage) upgradeTable() error {
+	getColumnSQL := fmt.Sprintf(GetOptionsColumnSQLFormat, s.table)
+
+	slog.Infof("SQL=%s", getColumnSQL)
+	rows, err := s.db.Query(getColumnSQL)
+	if err != nil {
+		return err
+	}
+
+	hasColumn := rows.Next()
+	rows.Close()
+	if hasColumn {
+		return nil
+	}
+
+	addColumnSQL := fmt.Sprintf(AddOptionsColumnSQLFormat, s.table)
+	slog.Infof("SQL=%s", addColumnSQL)
+	_, err = s.db.Exec(addColumnSQL)
+	return err
+}
+
+// Keys list all service keys, which id table exists
+func (s *MultiTableStorage) Keys() ([]string, error) {
+	keys, err := s.mysqlTable.Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	exists := make([]string, 0, len(keys))
+	for _, key := range keys {
+		table, err := s.keyTable(key)
+		if err != nil {
+			return nil, err
+		}
+
+		isExist, err := s.TableExist(table)
+		if err != nil {
+			return nil, err
+		}
+
+		if isExist {
+			exists = append(exists, key)
+		}
+	}
+
+	return exists, nil
+}
+
+// TableExist check the table exists
+func (s *MultiTableStorage) TableExist(table string) (bool, error) {
+	var tableName string
+	var haveValue bool
+
+	if len(table) == 0 {
+		return false, nil
+	}
+
+	getKeySQL := fmt.Sprintf(GetKeySQLFormat, table)
+	slog.Infof("SQL=%s", getKeySQL)
+	rows, err := s.db.Query(getKeySQL)
+	if err != nil {
+		return false, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&tableName)
+		if err != nil {
+			return false, err
+		}
+		haveValue = true
+	}
+
+	if haveValue == false {
+		return false, nil
+	}
+	return true, nil
+}
+
+// Exists check the key record exists on the manager table
+func (s *MultiTableStorage) Exists(key string) (bool, error) {
+	keyName := ""
+	selectKeySQL := fmt.Sprintf(SelectKeySQLFormat, s.table)
+
+	slog.Infof("SQL=%s key=%s", selectKeySQL, key)
+	rows, err := s.db.Query(selectKeySQL, key)
+	if err != nil {
+		return false, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		err := rows.Scan(&keyName)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return keyName != "", nil
+}
+
+// record the key on the manager table
+func (s *MultiTableStorage) setKey(key string) error {
+	isExist, err := s.Exists(key)
+	if err != nil || isExist {
+		return err
+	}
+
+	insertKeySQL := fmt.Sprintf(InsertKeySQLFormat, s.table)
+	slog.Infof("SQL=%s key=%s", insertKeySQL, key)
+	_, err = s.db.Exec(insertKeySQL, key)
+
+	return err
+}
+
+// Current get last id from the key table
+func (s *MultiTableStorage) Current(key string) (int64, error) {
+	var id int64
+	selectIdSQL := fmt.Sprintf(SelectIdSQLFormat, s.KeyTable(key))
+
+	slog.Infof("SQL=%s", selectIdSQL)
+	err := s.db.QueryRow(selectIdSQL).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	slog.Infof("get last id form db table: %s, last: %d", s.KeyTable(key), id)
+	return id, nil
+}
+
+// Alloc allocate an id range of size for the key
+func (s *MultiTableStorage) Alloc(key string, size int64) (int64, error) {
+	table := s.KeyTable(key)
+	selectForUpdate := fmt.Sprintf(SelectForUpdate, table)
+	updateIdSql := fmt.Sprintf(UpdateIdSQLFormat, table, size)
+
+	return s.allocInTx(key, selectForUpdate, nil, updateIdSql, nil)
+}
+
+// Wrap reset the id to id by one conditional update, only if the current id is not less than the threshold.
+// NOTICE: don't use the Reset(force=true) for wrap, it drops the table which other nodes are writing.
+func (s *MultiTableStorage) Wrap(key string, threshold, id int64) (int64, bool, error) {
+	wrapIdSQL := fmt.Sprintf(WrapIdSQLFormat, s.KeyTable(key))
+	wrapped, err := s.wrapByUpdate(wrapIdSQL, id, threshold)
+	if err != nil || wrapped {
+		return id, wrapped, err
+	}
+
+	cur, err := s.Current(key)
+	return cur, false, err
+}
+
+// Reset create the key table and record the key on the manager table.
+// if force is true, drop and create table directly
+// if force is false, create table use CreateTableNTSQLFormat
+func (s *MultiTableStorage) Reset(key string, idOffset int64, force bool) (int64, error) {
+	var err error
+	table := s.KeyTable(key)
+	createTableSQL := fmt.Sprintf(CreateTableSQLFormat, table)
+	createTableNtSQL := fmt.Sprintf(CreateTableNTSQLFormat, table)
+	dropTableSQL := fmt.Sprintf(DropTableSQLFormat, table)
+
+	if err = s.setKey(key); err != nil {
+		return 0, err
+	}
+
+	// drop table an create table
+	if force == true {
+		slog.Infof("SQL=%s", dropTableSQL)
+		_, err = s.db.Exec(dropTableSQL)
+		if err != nil {
+			return 0, err
+		}
+
+		slog.Infof("SQL=%s", createTableSQL)
+		_, err = s.db.Exec(createTableSQL)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		var rowCount int64
+		slog.Infof("SQL=%s", createTableNtSQL)
+		_, err = s.db.Exec(createTableNtSQL)
+		if err != nil {
+			return 0, err
+		}
+
+		// check the value if exist
+		getRowCountSQL := fmt.Sprintf(GetRowCountSQLFormat, table)
+
+		slog.Infof("SQL=%s", getRowCountSQL)
+		err = s.db.QueryRow(getRowCountSQL).Scan(&rowCount)
+		if err != nil {
+			return 0, err
+		}
+
+		// has record. update id to latest.
+		// NOTICE: dont update db id value to `idOffset`.
+		if rowCount == int64(1) {
+			return s.Current(key)
+		}
+	}
+
+	insertIdSQL := fmt.Sprintf(InsertIdSQLFormat, table, idOffset)
+	slog.Infof("SQL=%s", insertIdSQL)
+	_, err = s.db.Exec(insertIdSQL)
+	if err != nil {
+		s.db.Exec(dropTableSQL)
+		return 0, err
+	}
+
+	return idOffset, nil
+}
+
+// Delete drop the key table and delete the key record
+func (s *MultiTableStorage) Delete(key string) error {
+	dropTableSQL := fmt.Sprintf(DropTableSQLFormat, s.KeyTable(key))
+
+	slog.Infof("SQL=%s", dropTableSQL)
+	_, err := s.db.Exec(dropTableSQL)
+	if err != nil {
+		return err
+	}
+	s.forgetTable(key)
+
+	deleteKeySQL := fmt.Sprintf(DeleteKeySQLFormat, s.table)
+	slog.Infof("SQL=%s key=%s", deleteKeySQL, key)
+	_, err = s.db.Exec(deleteKeySQL, key)
+	return err
+}
@@ -3,29 +3,105 @@ package mysqlid
 import (
 	"database/sql"
 	"fmt"
+	"sync"
 
+	_ "github.com/go-sql-driver/mysql"
 	"github.com/gookit/slog"
+	"github.com/inherelab/genid/snowflake"
 )
 
 var Db *sql.DB
-var cfg = &Config{
-	TableName: "__idgen_manager",
-}
+var cfg = NewConfig()
+
+// the storage drivers
+const (
+	StorageMySQL    = "mysql"
+	StorageSQLite   = "sqlite"
+	StoragePostgres = "postgres"
+	StorageFile     = "file"
+	StorageMemory   = "memory"
+)
+
+// the table modes
+const (
+	// TableModeMulti create one table for each service, and record services on the manager table.
+	TableModeMulti = "multi"
+	// TableModeSingle all services are stored as rows in one table.
+	TableModeSingle = "single"
+)
 
 // Config struct
 type Config struct {
 	// the server listen addr
-	Addr     string `toml:"addr"`
-	LogPath  string `toml:"log_path"`
-	LogLevel string `toml:"log_level"`
+	Addr     string `toml:"addr" mapstructure:"addr"`
+	LogPath  string `toml:"log_path" mapstructure:"log_path"`
+	LogLevel string `toml:"log_level" mapstructure:"log_level"`
+	// Storage the storage driver. allow: mysql, sqlite, postgres, file, memory. default is mysql
+	Storage string `toml:"storage" mapstructure:"storage"`
+
+	BatchCount int64 `toml:"batch_count" mapstructure:"batch_count"`
+	// TableMode allow: multi, single. default is multi
+	TableMode string `toml:"table_mode" mapstructure:"table_mode"`
+	// TableName the manager table name on multi mode, the id table name on single mode.
+	TableName string `toml:"table_name" mapstructure:"table_name"`
+	// TablePrefix the prefix of service id table name on multi mode.
+	TablePrefix string `toml:"table_prefix" mapstructure:"table_prefix"`
+
+	// DoubleBuffer preload next segment on background, so that Next() no need wait db query.
+	DoubleBuffer bool `toml:"double_buffer" mapstructure:"double_buffer"`
+	// PreloadRatio start preload when the used ratio of current segment reached it. default is 0.1
+	PreloadRatio float64 `toml:"preload_ratio" mapstructure:"preload_ratio"`
 
-	BatchCount  int64  `toml:"batch_count"`
-	TableMode   string `toml:"table_mode"`
-	TableName   string `toml:"table_name"`
-	TablePrefix string `toml:"table_prefix"`
+	// AdaptiveBatch adjust the batch count between MinBatch and MaxBatch by the consumption rate,
+	// to fetch segment from db once per BatchPeriod seconds.
+	AdaptiveBatch bool  `toml:"adaptive_batch" mapstructure:"adaptive_batch"`
+	MinBatch      int64 `toml:"min_batch" mapstructure:"min_batch"`
+	MaxBatch      int64 `toml:"max_batch" mapstructure:"max_batch"`
+	BatchPeriod   int64 `toml:"batch_period" mapstructure:"batch_period"`
+
+	// ExhaustAlerts the default thresholds ratio of the max_id to emit warnings
+	ExhaustAlerts []float64 `toml:"exhaust_alerts" mapstructure:"exhaust_alerts"`
+
+	// Ledger record every allocated segment and reset of the services on the ledger table, for auditing.
+	// the Manager init fails if the storage is not a Ledger.
+	Ledger bool `toml:"ledger" mapstructure:"ledger"`
+	// NodeName the identity of the genid node on the ledger. default is "hostname-pid"
+	NodeName string `toml:"node_name" mapstructure:"node_name"`
+
+	// Snowflake the settings of the snowflake services
+	Snowflake *snowflake.Config `toml:"snowflake" mapstructure:"snowflake"`
 
 	// db config
-	DbConfig *DBConfig `toml:"db"`
+	DbConfig *DBConfig `toml:"db" mapstructure:"db"`
+}
+
+// NewConfig create config with default settings
+func NewConfig() *Config {
+	return &Config{
+		Storage:      StorageMySQL,
+		TableMode:    TableModeMulti,
+		TableName:    ManagerTableName,
+		BatchCount:   BatchCount,
+		DoubleBuffer: true,
+		PreloadRatio: PreloadRatio,
+		MinBatch:     MinBatchCount,
+		MaxBatch:     MaxBatchCount,
+		BatchPeriod:  BatchPeriod,
+		Snowflake:    snowflake.NewConfig(),
+		DbConfig:     &DBConfig{},
+		// warning at 80% and 95% of the max_id
+		ExhaustAlerts: []float64{0.8, 0.95},
+	}
+}
+
+// SingleTable check is single table mode
+func (c *Config) SingleTable() bool {
+	return c.TableMode == TableModeSingle
+}
+
+// SetConfig set config
+func SetConfig(c *Config) {
+	cfg = c
 }
 
 // CreateSqlDB
@@ -80,3 +156,144 @@ func InitSqlDB(cfg *DBConfig) (*sql.DB, error) {
 	Db, err = sql.Open(proto, url)
 	return Db, err
 }
+
+// NewMySQLStorage create the MySQL storage by the Config.TableMode
+func NewMySQLStorage(db *sql.DB) Storage {
+	if cfg.SingleTable() {
+		return NewSingleTableStorage(db, cfg.TableName)
+	}
+	return NewMultiTableStorage(db, cfg.TableName, cfg.TablePrefix)
+}
+
+const (
+	SelectOptionsSQLFormat = "SELECT `options` FROM `%s` WHERE `k` = ?"
+	UpdateOptionsSQLFormat = "UPDATE `%s` SET `options` = ? WHERE `k` = ?"
+)
+
+// mysqlTable the common methods for the table has columns (k, options)
+type mysqlTable struct {
+	db *sql.DB
+	// the manager table on multi mode, the id table on single mode.
+	table string
+
+	// mark the lease table is created
+	leaseLock  sync.Mutex
+	leaseReady bool
+	// mark the ledger table is created
+	ledgerLock  sync.Mutex
+	ledgerReady bool
+}
+
+// DB get the sql db
+func (t *mysqlTable) DB() *sql.DB {
+	return t.db
+}
+
+// Keys list all service keys
+func (t *mysqlTable) Keys() ([]string, error) {
+	selectKeysSQL := fmt.Sprintf(SelectKeysSQLFormat, t.table)
+
+	slog.Infof("SQL=%s", selectKeysSQL)
+	rows, err := t.db.Query(selectKeysSQL)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		key := ""
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, rows.Err()
+}
+
+// Options get service options of the key
+func (t *mysqlTable) Options(key string) (*Options, error) {
+	var str string
+	selectOptionsSQL := fmt.Sprintf(SelectOptionsSQLFormat, t.table)
+
+	slog.Debugf("SQL=%s key=%s", selectOptionsSQL, key)
+	err := t.db.QueryRow(selectOptionsSQL, key).Scan(&str)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	return ParseOptions(str)
+}
+
+// SaveOptions save service options of the key
+func (t *mysqlTable) SaveOptions(key string, opts *Options) error {
+	updateOptionsSQL := fmt.Sprintf(UpdateOptionsSQLFormat, t.table)
+
+	slog.Infof("SQL=%s key=%s options=%s", updateOptionsSQL, key, opts.String())
+	_, err := t.db.Exec(updateOptionsSQL, opts.String(), key)
+	return err
+}
+
+// select the id for update, and update it in a transaction. returns the selected id
+// wrap the id by the conditional update sql, returns wrapped=true if the row is updated.
+func (t *mysqlTable) wrapByUpdate(wrapSQL string, args ...interface{}) (bool, error) {
+	slog.Infof("SQL=%s args=%v", wrapSQL, args)
+	ret, err := t.db.Exec(wrapSQL, args...)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := ret.RowsAffected()
+	return n > 0, err
+}
+
+func (t *mysqlTable) allocInTx(key, selectSQL string, selectArgs []interface{}, updateSQL string, updateArgs []interface{}) (int64, error) {
+	var id int64
+	var haveValue bool
+
+	tx, err := t.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	slog.Infof("SQL=%s", selectSQL)
+	rows, err := tx.Query(selectSQL, selectArgs...)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	for rows.Next() {
+		err := rows.Scan(&id)
+		if err != nil {
+			rows.Close()
+			tx.Rollback()
+			return 0, err
+		}
+		haveValue = true
+	}
+	rows.Close()
+
+	// When the table has no id name
+	if haveValue == false {
+		tx.Rollback()
+		return 0, fmt.Errorf("%s: have no id name", key)
+	}
+
+	slog.Infof("dbId=%d SQL=%s", id, updateSQL)
+	_, err = tx.Exec(updateSQL, updateArgs...)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
@@ -0,0 +1,146 @@
+package mysqlid_test
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/inherelab/genid/idtest"
+	"github.com/inherelab/genid/mysqlid"
+)
+
+// open the MySQL by the dsn of the mysqlid.TestMySQLEnv, skip the test if it's not set.
+func testMySQLDB(tb testing.TB) *sql.DB {
+	dsn := os.Getenv(mysqlid.TestMySQLEnv)
+	if dsn == "" {
+		tb.Skip("skip the MySQL test: the env " + mysqlid.TestMySQLEnv + " is not set")
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	if err == nil {
+		err = db.Ping()
+	}
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return db
+}
+
+// drop the test tables
+func dropTables(tb testing.TB, db *sql.DB, tables ...string) {
+	for _, table := range tables {
+		if _, err := db.Exec(fmt.Sprintf(mysqlid.DropTableSQLFormat, table)); err != nil {
+			tb.Fatal(err)
+		}
+	}
+}
+
+// the table name of this run, so the tests can be run repeatedly on the same database
+func testTable(name string) string {
+	return fmt.Sprintf("_idtest_%s_%d", name, time.Now().UnixNano())
+}
+
+func TestMultiTableStorage(t *testing.T) {
+	db := testMySQLDB(t)
+	defer db.Close()
+
+	manager := testTable("multi")
+	prefix := manager + "_"
+	defer func() {
+		store := mysqlid.NewMultiTableStorage(db, manager, prefix)
+		keys, _ := store.Keys()
+		for _, key := range keys {
+			_ = store.Delete(key)
+		}
+		dropTables(t, db, manager, manager+mysqlid.LeaseTableSuffix)
+	}()
+
+	idtest.RunStorage(t, func(t *testing.T) mysqlid.Storage {
+		return mysqlid.NewMultiTableStorage(db, manager, prefix)
+	})
+}
+
+func TestSingleTableStorage(t *testing.T) {
+	db := testMySQLDB(t)
+	defer db.Close()
+
+	table := testTable("single")
+	defer dropTables(t, db, table, table+mysqlid.LeaseTableSuffix)
+
+	idtest.RunStorage(t, func(t *testing.T) mysqlid.Storage {
+		return mysqlid.NewSingleTableStorage(db, table)
+	})
+}
+
+func TestMultiTableStorage_legacyTable(t *testing.T) {
+	db := testMySQLDB(t)
+	defer db.Close()
+
+	manager, key := testTable("legacy"), "idgen_legacy"
+	dropTables(t, db, key, "gid_key_"+key)
+	defer dropTables(t, db, manager, key, "gid_key_"+key)
+
+	// the table is named by the bare key before the table_prefix is set
+	legacy := mysqlid.NewMultiTableStorage(db, manager, "")
+	if err := legacy.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := legacy.Reset(key, 100, false); err != nil {
+		t.Fatal(err)
+	}
+
+	upgraded := mysqlid.NewMultiTableStorage(db, manager, "gid_key_")
+	keys, err := upgraded.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != key {
+		t.Fatalf("the legacy service should be listed after upgrade, but got %v", keys)
+	}
+
+	// the service is not reset by SET, and continues on the legacy table
+	if id, err := upgraded.Reset(key, 0, false); err != nil || id != 100 {
+		t.Fatalf("the current id should be kept 100, but got %d, err: %v", id, err)
+	}
+	if start, err := upgraded.Alloc(key, 10); err != nil || start != 100 {
+		t.Fatalf("the allocated range should start from 100, but got %d, err: %v", start, err)
+	}
+	if id, _ := legacy.Current(key); id != 110 {
+		t.Fatalf("the legacy table should be used, but its id is %d", id)
+	}
+}
+
+func TestMultiTableStorage_legacyManagerTable(t *testing.T) {
+	db := testMySQLDB(t)
+	defer db.Close()
+
+	store := mysqlid.NewMultiTableStorage(db, mysqlid.ManagerTableName, "")
+	if ok, err := store.TableExist(mysqlid.ManagerTableName); err != nil || ok {
+		t.Skipf("skip the test: the legacy table %s exists on the test database, err: %v", mysqlid.ManagerTableName, err)
+	}
+
+	manager, key := testTable("manager"), testTable("legacy_key")
+	defer dropTables(t, db, mysqlid.ManagerTableName, manager, key)
+
+	// the services created by the old version
+	if err := store.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Reset(key, 100, false); err != nil {
+		t.Fatal(err)
+	}
+
+	upgraded := mysqlid.NewMultiTableStorage(db, manager, "gid_key_")
+	if err := upgraded.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := upgraded.TableExist(manager); ok {
+		t.Fatalf("the manager table %s should not be created on the legacy table exists", manager)
+	}
+	if id, err := upgraded.Reset(key, 0, false); err != nil || id != 100 {
+		t.Fatalf("the current id should be kept 100, but got %d, err: %v", id, err)
+	}
+}
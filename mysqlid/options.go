@@ -0,0 +1,357 @@
+package mysqlid
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/inherelab/genid/hashid"
+)
+
+// the service types
+const (
+	// TypeSegment fetch the id segment from the storage. it's the default type
+	TypeSegment = "segment"
+	// TypeSnowflake generate the time-based id by the snowflake generator, without the storage.
+	TypeSnowflake = "snowflake"
+	// TypeULID generate the ULID string ids, without the storage.
+	TypeULID = "ulid"
+	// TypeUUIDv7 generate the UUIDv7 string ids, without the storage.
+	TypeUUIDv7 = "uuidv7"
+
+	// the segment service with the time scope
+	typeScoped = "scoped"
+)
+
+// the exhausted policies, on the id reached the max_id
+const (
+	// ExhaustedError returns ErrIdExhausted. it's the default policy
+	ExhaustedError = "error"
+	// ExhaustedWrap wrap the id to the min_id
+	ExhaustedWrap = "wrap"
+	// ExhaustedBlock block until the max_id is raised
+	ExhaustedBlock = "block"
+)
+
+// the time scopes of the counter, the counter is reset on each time bucket.
+const (
+	ScopeHour  = "hour"
+	ScopeDay   = "day"
+	ScopeMonth = "month"
+
+	// KeepBuckets the default count of kept buckets, include the current bucket
+	KeepBuckets = 3
+	// PadWidth the default width of the zero padded counter on formatted value
+	PadWidth = 6
+)
+
+// Options for an id generator service.
+// it's stored on the manager table as json, so that all nodes use the same settings.
+type Options struct {
+	// Type the service type. allow: segment, snowflake, ulid, uuidv7. default is segment
+	Type string `json:"type,omitempty"`
+
+	// Batch get batch count ids from db once. if is 0, will use Config.BatchCount.
+	// it's not adjusted by the Config.AdaptiveBatch, unless the MinBatch or MaxBatch is set.
+	Batch int64 `json:"batch,omitempty"`
+
+	// adaptive batch settings, the batch count will be adjusted between MinBatch and MaxBatch,
+	// to fetch segment from db once per Period seconds.
+	// if is 0, will use the Config.MinBatch, Config.MaxBatch, Config.BatchPeriod
+	MinBatch int64 `json:"min_batch,omitempty"`
+	MaxBatch int64 `json:"max_batch,omitempty"`
+	Period   int64 `json:"period,omitempty"`
+
+	// Step and Offset generate the ids which id % Step == Offset % Step, like the auto_increment_increment and
+	// auto_increment_offset of MySQL. eg: Step=2, the ids of Offset=1 are odd, the ids of Offset=2 are even.
+	Step   int64 `json:"step,omitempty"`
+	Offset int64 `json:"offset,omitempty"`
+
+	// MaxId the max id of the service, 0 is unlimited. handle the id reached it by the Exhausted policy.
+	MaxId int64 `json:"max_id,omitempty"`
+	// MinId the first id after wrapped, default is 1
+	MinId int64 `json:"min_id,omitempty"`
+	// Exhausted the policy on the id reached the MaxId. allow: error, wrap, block. default is error
+	Exhausted string `json:"exhausted,omitempty"`
+	// Alerts the thresholds ratio of the MaxId to emit warnings. if empty, will use the Config.ExhaustAlerts
+	Alerts []float64 `json:"alerts,omitempty"`
+
+	// Scope the time bucket of the counter. allow: hour, day, month. the counter is reset on each bucket,
+	// and the formatted value is "{bucket}-{counter}". eg: "20261018-000123"
+	Scope string `json:"scope,omitempty"`
+	// TZ the time zone of the bucket. eg: "Asia/Shanghai", default is the local time zone
+	TZ string `json:"tz,omitempty"`
+	// Keep the count of kept buckets, the old buckets will be deleted. default is KeepBuckets
+	Keep int64 `json:"keep,omitempty"`
+	// Pad the width of the zero padded counter on formatted value. default is PadWidth
+	Pad int64 `json:"pad,omitempty"`
+
+	// Format the format template of the ids, see Template. eg: "INV-{date:yyyyMMdd}-{seq:08}{luhn}"
+	// if not empty, the string ids(eg: redis GET) are formatted by it. the raw id is still available.
+	Format string `json:"format,omitempty"`
+
+	// Salt the salt of the encoded ids, see hashid.Encoder. keep it secret.
+	Salt string `json:"salt,omitempty"`
+	// Alphabet the alphabet of the encoded ids, default is hashid.DefaultAlphabet
+	Alphabet string `json:"alphabet,omitempty"`
+	// MinLength the min length of the encoded ids
+	MinLength int64 `json:"min_length,omitempty"`
+}
+
+// ParseOptions parse options from json string
+func ParseOptions(str string) (*Options, error) {
+	opts := &Options{}
+	if str == "" {
+		return opts, nil
+	}
+
+	if err := json.Unmarshal([]byte(str), opts); err != nil {
+		return nil, fmt.Errorf("invalid service options: %s", err.Error())
+	}
+	return opts, nil
+}
+
+// Set option value by name. eg: Set("batch", "5000")
+func (o *Options) Set(name, value string) error {
+	name = strings.ToLower(name)
+
+	switch name {
+	case "type":
+		value = strings.ToLower(value)
+		if !validType(value) {
+			return fmt.Errorf("option type: unknown service type %s", value)
+		}
+		o.Type = value
+	case "exhausted":
+		value = strings.ToLower(value)
+		switch value {
+		case "", ExhaustedError, ExhaustedWrap, ExhaustedBlock:
+			o.Exhausted = value
+		default:
+			return fmt.Errorf("option exhausted: allow error, wrap, block")
+		}
+	case "scope":
+		value = strings.ToLower(value)
+		switch value {
+		case "", ScopeHour, ScopeDay, ScopeMonth:
+			o.Scope = value
+		default:
+			return fmt.Errorf("option scope: allow hour, day, month")
+		}
+	case "tz":
+		if _, err := time.LoadLocation(value); err != nil {
+			return fmt.Errorf("option tz: %s", err.Error())
+		}
+		o.TZ = value
+	case "format":
+		if value != "" {
+			if _, err := ParseTemplate(value); err != nil {
+				return err
+			}
+		}
+		o.Format = value
+	case "salt":
+		o.Salt = value
+	case "alphabet":
+		if value != "" {
+			if _, err := hashid.New("", value, 0); err != nil {
+				return err
+			}
+		}
+		o.Alphabet = value
+	case "alerts":
+		alerts, err := parseAlerts(value)
+		if err != nil {
+			return err
+		}
+		o.Alerts = alerts
+	case "batch", "min_batch", "max_batch", "period", "step", "offset", "max_id", "min_id", "keep", "pad", "min_length":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("option %s: expected integer", name)
+		}
+
+		switch name {
+		case "batch":
+			o.Batch = n
+		case "min_batch":
+			o.MinBatch = n
+		case "max_batch":
+			o.MaxBatch = n
+		case "period":
+			o.Period = n
+		case "step":
+			o.Step = n
+		case "offset":
+			o.Offset = n
+		case "max_id":
+			o.MaxId = n
+		case "min_id":
+			o.MinId = n
+		case "keep":
+			o.Keep = n
+		case "pad":
+			o.Pad = n
+		case "min_length":
+			o.MinLength = n
+		}
+	default:
+		return fmt.Errorf("unknown option: %s", name)
+	}
+	return nil
+}
+
+// Validate options settings
+func (o *Options) Validate() error {
+	if !validType(o.Type) {
+		return fmt.Errorf("unknown service type: %s", o.Type)
+	}
+	if o.Batch < 0 || o.MinBatch < 0 || o.MaxBatch < 0 {
+		return fmt.Errorf("invalid batch count: %d", o.Batch)
+	}
+	if o.MaxBatch > 0 && o.MinBatch > o.MaxBatch {
+		return fmt.Errorf("min_batch %d is greater than max_batch %d", o.MinBatch, o.MaxBatch)
+	}
+	if o.Period < 0 {
+		return fmt.Errorf("invalid batch period: %d", o.Period)
+	}
+	if o.Step < 0 || o.Offset < 0 {
+		return fmt.Errorf("invalid step %d or offset %d", o.Step, o.Offset)
+	}
+	if o.Offset > o.StepOr() {
+		return fmt.Errorf("the offset %d is greater than the step %d", o.Offset, o.StepOr())
+	}
+	if o.MaxId < 0 || o.MinId < 0 {
+		return fmt.Errorf("invalid max_id %d or min_id %d", o.MaxId, o.MinId)
+	}
+	if o.MaxId > 0 && o.Align(o.MinIdOr()) > o.MaxId {
+		return fmt.Errorf("the min_id %d is greater than the max_id %d", o.MinIdOr(), o.MaxId)
+	}
+	if o.Scope != "" && o.ServiceType() != TypeSegment {
+		return fmt.Errorf("the scope only supports the segment service")
+	}
+	if o.Keep < 0 || o.Pad < 0 || o.Pad > 19 {
+		return fmt.Errorf("invalid keep %d or pad %d", o.Keep, o.Pad)
+	}
+	if o.Format != "" {
+		if o.ServiceType() == TypeULID || o.ServiceType() == TypeUUIDv7 {
+			return fmt.Errorf("the format only supports the int64 ids")
+		}
+		if _, err := ParseTemplate(o.Format); err != nil {
+			return err
+		}
+	}
+	if _, err := o.Encoder(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ServiceType get the service type, default is TypeSegment
+func (o *Options) ServiceType() string {
+	if o.Type == "" {
+		return TypeSegment
+	}
+	return o.Type
+}
+
+// Location get the time zone by the TZ, default is the local time zone
+func (o *Options) Location() *time.Location {
+	if o.TZ != "" {
+		if loc, err := time.LoadLocation(o.TZ); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// Encoder create the encoder of the ids by the Salt, Alphabet and MinLength
+func (o *Options) Encoder() (*hashid.Encoder, error) {
+	return hashid.New(o.Salt, o.Alphabet, int(o.MinLength))
+}
+
+// the kind of the service generator, the segment service with the scope is typeScoped
+func (o *Options) kind() string {
+	if o.Scope != "" && o.ServiceType() == TypeSegment {
+		return typeScoped
+	}
+	return o.ServiceType()
+}
+
+func validType(typ string) bool {
+	switch typ {
+	case "", TypeSegment, TypeSnowflake, TypeULID, TypeUUIDv7:
+		return true
+	}
+	return false
+}
+
+// StepOr get the step of ids, default is 1
+func (o *Options) StepOr() int64 {
+	if o.Step > 1 {
+		return o.Step
+	}
+	return 1
+}
+
+// Align get the smallest id which is not less than id, and id % Step == Offset % Step
+func (o *Options) Align(id int64) int64 {
+	step := o.StepOr()
+	if step == 1 {
+		return id
+	}
+
+	return id + ((o.Offset-id)%step+step)%step
+}
+
+// MinIdOr get the min id, default is 1
+func (o *Options) MinIdOr() int64 {
+	if o.MinId > 0 {
+		return o.MinId
+	}
+	return 1
+}
+
+// AlertsOr get the alert thresholds, will return defVal on not setting.
+func (o *Options) AlertsOr(defVal []float64) []float64 {
+	if len(o.Alerts) > 0 {
+		return o.Alerts
+	}
+	return defVal
+}
+
+// parse the alert thresholds. eg: "0.8,0.95"
+func parseAlerts(value string) ([]float64, error) {
+	var alerts []float64
+	for _, str := range strings.Split(value, ",") {
+		if str = strings.TrimSpace(str); str == "" {
+			continue
+		}
+
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil || f <= 0 || f >= 1 {
+			return nil, fmt.Errorf("option alerts: expected the ratios in (0, 1). eg: 0.8,0.95")
+		}
+		alerts = append(alerts, f)
+	}
+
+	sort.Float64s(alerts)
+	return alerts, nil
+}
+
+// BatchOr get batch count, will return defVal on not setting.
+func (o *Options) BatchOr(defVal int64) int64 {
+	if o.Batch > 0 {
+		return o.Batch
+	}
+	return defVal
+}
+
+// String encode to json string
+func (o *Options) String() string {
+	bs, _ := json.Marshal(o)
+	return string(bs)
+}
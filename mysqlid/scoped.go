@@ -0,0 +1,333 @@
+package mysqlid
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gookit/slog"
+)
+
+// ScopedSep the separator of the service name and the time bucket on the storage key.
+// eg: the bucket key "order_no__20261018" of the service "order_no"
+const ScopedSep = "__"
+
+// the time layouts of the buckets
+var scopeLayouts = map[string]string{
+	ScopeHour:  "2006010215",
+	ScopeDay:   "20060102",
+	ScopeMonth: "200601",
+}
+
+// ScopedService the segment service which the counter is reset on each time bucket(Options.Scope).
+//
+// the counter of each bucket is stored on the key "{name}__{bucket}", the old buckets
+// beyond the Options.Keep are deleted on the bucket changed.
+// the formatted id is "{bucket}-{counter}", eg: "20261018-000123", or by the template of Options.Format.
+type ScopedService struct {
+	serviceMeta
+
+	// the lock for the bucket state
+	mu     sync.Mutex
+	loc    *time.Location
+	tpl    *Template
+	bucket string
+	at     time.Time // the time of the bucket created
+	gen    *Generator
+	// the clock, can be replaced on tests
+	now func() time.Time
+}
+
+// NewScopedService instance
+func NewScopedService(store Storage, serviceName string) *ScopedService {
+	return &ScopedService{
+		serviceMeta: serviceMeta{
+			store: store,
+			name:  serviceName,
+			opts:  &Options{},
+		},
+		loc: time.Local,
+		now: time.Now,
+	}
+}
+
+// Init load the service options from storage, and the counter of the current bucket
+func (s *ScopedService) Init() error {
+	opts, err := s.store.Options(s.name)
+	if err != nil {
+		return err
+	}
+
+	s.SetOptions(opts)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.gen = nil
+	return s.rotate()
+}
+
+// Bucket get the current time bucket. eg: "20261018"
+func (s *ScopedService) Bucket() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.bucket
+}
+
+// Current get the current counter of the bucket
+func (s *ScopedService) Current() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.gen == nil {
+		return 0
+	}
+	return s.gen.Current()
+}
+
+// Next generate next counter of the current bucket
+func (s *ScopedService) Next() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.rotate(); err != nil {
+		return 0, err
+	}
+	return s.gen.Next()
+}
+
+// NextN generate n counters of the current bucket
+func (s *ScopedService) NextN(n int) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.rotate(); err != nil {
+		return nil, err
+	}
+	return s.gen.NextN(n)
+}
+
+// CurrentString get the current formatted id
+func (s *ScopedService) CurrentString() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.gen == nil {
+		return ""
+	}
+	return s.format(s.gen.Current())
+}
+
+// NextString generate next formatted id. eg: "20261018-000123"
+func (s *ScopedService) NextString() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.rotate(); err != nil {
+		return "", err
+	}
+
+	id, err := s.gen.Next()
+	if err != nil {
+		return "", err
+	}
+	return s.format(id), nil
+}
+
+// NextStrings generate n formatted ids, all ids are in the same bucket.
+func (s *ScopedService) NextStrings(n int) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.rotate(); err != nil {
+		return nil, err
+	}
+
+	ids, err := s.gen.NextN(n)
+	if err != nil {
+		return nil, err
+	}
+
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = s.format(id)
+	}
+	return strs, nil
+}
+
+// Reset record the service on the storage, and reset the counter of the current bucket.
+func (s *ScopedService) Reset(idOffset int64, force bool) error {
+	if _, err := s.store.Reset(s.name, 0, false); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.rotate(); err != nil {
+		return err
+	}
+	return s.gen.Reset(idOffset, force)
+}
+
+// SetOptions set the service options, the options are applied to the counter of the current bucket.
+func (s *ScopedService) SetOptions(opts *Options) {
+	s.serviceMeta.SetOptions(opts)
+
+	var tpl *Template
+	if opts.Format != "" {
+		tpl, _ = ParseTemplate(opts.Format)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.loc = opts.Location()
+	s.tpl = tpl
+	if s.gen == nil {
+		return
+	}
+
+	bucketOpts := bucketOptions(opts)
+	if err := s.store.SaveOptions(s.gen.Name(), bucketOpts); err != nil {
+		slog.Errorf("%s: save the options of bucket %s error: %s", s.name, s.bucket, err.Error())
+	}
+	s.gen.SetOptions(bucketOpts)
+}
+
+// DeleteBuckets delete the counters of all buckets from the storage
+func (s *ScopedService) DeleteBuckets() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys, err := s.bucketKeys()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if err = s.store.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	s.gen = nil
+	s.bucket = ""
+	return nil
+}
+
+// switch the counter to the bucket of now, if the bucket changed.
+func (s *ScopedService) rotate() error {
+	opts := s.Options()
+	now := s.now().In(s.loc)
+	bucket := now.Format(scopeLayouts[opts.Scope])
+	if s.gen != nil && bucket == s.bucket {
+		return nil
+	}
+
+	key := s.name + ScopedSep + bucket
+	gen, err := NewGenerator(s.store, key)
+	if err != nil {
+		return err
+	}
+
+	// create the bucket key, the counter is kept if it was created by other nodes
+	if _, err = s.store.Reset(key, 0, false); err != nil {
+		return err
+	}
+	if err = s.store.SaveOptions(key, bucketOptions(&opts)); err != nil {
+		return err
+	}
+	if err = gen.Init(); err != nil {
+		return err
+	}
+
+	s.gen = gen
+	s.bucket = bucket
+	s.at = now
+	s.cleanup(opts.Keep)
+	return nil
+}
+
+// delete the old buckets before the kept buckets. the error is only logged.
+func (s *ScopedService) cleanup(keep int64) {
+	if keep <= 0 {
+		keep = KeepBuckets
+	}
+
+	keys, err := s.bucketKeys()
+	if err != nil {
+		slog.Errorf("%s: list the buckets error: %s", s.name, err.Error())
+		return
+	}
+
+	// only delete the buckets before current, the later buckets maybe used by other nodes.
+	current := s.name + ScopedSep + s.bucket
+	old := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key < current {
+			old = append(old, key)
+		}
+	}
+
+	sort.Strings(old)
+	for i := 0; i < len(old)-int(keep-1); i++ {
+		slog.Infof("%s: delete the old bucket key %s", s.name, old[i])
+		if err = s.store.Delete(old[i]); err != nil {
+			slog.Errorf("%s: delete the bucket key %s error: %s", s.name, old[i], err.Error())
+		}
+	}
+}
+
+// list the bucket keys of the service on the storage
+func (s *ScopedService) bucketKeys() ([]string, error) {
+	keys, err := s.store.Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	scope := s.Options().Scope
+	bucketKeys := make([]string, 0, 4)
+	for _, key := range keys {
+		if isBucketKey(key, s.name, scope) {
+			bucketKeys = append(bucketKeys, key)
+		}
+	}
+	return bucketKeys, nil
+}
+
+// check the key is "{name}__{bucket}" and the bucket is formatted by the scope layout,
+// so the service named like "{name}__foo" is not a bucket key.
+func isBucketKey(key, name, scope string) bool {
+	layout, ok := scopeLayouts[scope]
+	prefix := name + ScopedSep
+	if !ok || len(key) != len(prefix)+len(layout) || !strings.HasPrefix(key, prefix) {
+		return false
+	}
+
+	_, err := time.Parse(layout, key[len(prefix):])
+	return err == nil
+}
+
+// format the counter as "{bucket}-{counter}", or by the template
+func (s *ScopedService) format(id int64) string {
+	if s.tpl != nil {
+		return s.tpl.Format(id, s.at)
+	}
+
+	pad := s.Options().Pad
+	if pad <= 0 {
+		pad = PadWidth
+	}
+	return fmt.Sprintf("%s-%0*d", s.bucket, pad, id)
+}
+
+// the options of the bucket counter, without the scope settings
+func bucketOptions(opts *Options) *Options {
+	bo := *opts
+	bo.Scope, bo.TZ, bo.Keep, bo.Pad, bo.Format = "", "", 0, 0, ""
+	return &bo
+}
@@ -0,0 +1,194 @@
+package mysqlid
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/inherelab/genid"
+	"github.com/inherelab/genid/snowflake"
+	"github.com/inherelab/genid/strid"
+)
+
+// ErrStringService the service generates the string ids, can not get the int64 id.
+var ErrStringService = errors.New("the service generates the string ids, please use NextString")
+
+// MaxBulkCount the max count of ids on bulk fetch once
+const MaxBulkCount = 100000
+
+// BulkGenerator the generator can generate n ids in one locked operation
+type BulkGenerator interface {
+	NextN(n int) ([]int64, error)
+}
+
+// BulkStringGenerator the generator can generate n string ids in one locked operation
+type BulkStringGenerator interface {
+	NextStrings(n int) ([]string, error)
+}
+
+// ServiceGenerator the id generator of a service. the Manager creates it by the service type(Options.Type).
+type ServiceGenerator interface {
+	genid.GeneratorFace
+	// Name get the service name
+	Name() string
+	// Init load the service state from the storage
+	Init() error
+	// Reset the service id, see Generator.Reset
+	Reset(idOffset int64, force bool) error
+	// Options get a copy of the service options
+	Options() Options
+	// SetOptions set the service options
+	SetOptions(opts *Options)
+}
+
+var (
+	_ ServiceGenerator          = (*Generator)(nil)
+	_ ServiceGenerator          = (*SnowflakeService)(nil)
+	_ ServiceGenerator          = (*StringService)(nil)
+	_ genid.StringGeneratorFace = (*StringService)(nil)
+	_ ServiceGenerator          = (*ScopedService)(nil)
+	_ genid.StringGeneratorFace = (*ScopedService)(nil)
+
+	_ BulkGenerator       = (*Generator)(nil)
+	_ BulkGenerator       = (*SnowflakeService)(nil)
+	_ BulkStringGenerator = (*StringService)(nil)
+	_ BulkGenerator       = (*ScopedService)(nil)
+	_ BulkStringGenerator = (*ScopedService)(nil)
+)
+
+// serviceMeta the common methods of the services, which not generate ids from the storage.
+// the storage only records the service and the options.
+type serviceMeta struct {
+	store Storage
+	name  string
+
+	lock sync.Mutex
+	opts *Options
+}
+
+// Init load the service options from storage
+func (s *serviceMeta) Init() error {
+	opts, err := s.store.Options(s.name)
+	if err != nil {
+		return err
+	}
+
+	s.SetOptions(opts)
+	return nil
+}
+
+// Name get service name
+func (s *serviceMeta) Name() string {
+	return s.name
+}
+
+// Reset only record the service on the storage, the id can not be reset.
+func (s *serviceMeta) Reset(_ int64, _ bool) error {
+	_, err := s.store.Reset(s.name, 0, false)
+	return err
+}
+
+// Options get a copy of the service options
+func (s *serviceMeta) Options() Options {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return *s.opts
+}
+
+// SetOptions set the service options
+func (s *serviceMeta) SetOptions(opts *Options) {
+	s.lock.Lock()
+	s.opts = opts
+	s.lock.Unlock()
+}
+
+// SnowflakeService the service generate ids by the snowflake generator.
+type SnowflakeService struct {
+	*snowflake.Generator
+	serviceMeta
+
+	// the leased worker id. Next() returns error after the lease lost
+	lease *workerLease
+}
+
+// NewSnowflakeService instance
+func NewSnowflakeService(store Storage, serviceName string, c *snowflake.Config) (*SnowflakeService, error) {
+	gen, err := snowflake.New(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SnowflakeService{
+		Generator: gen,
+		serviceMeta: serviceMeta{
+			store: store,
+			name:  serviceName,
+			opts:  &Options{Type: TypeSnowflake},
+		},
+	}, nil
+}
+
+// Next generate next id. returns ErrLeaseLost if the leased worker id is lost.
+func (s *SnowflakeService) Next() (int64, error) {
+	if err := s.checkLease(); err != nil {
+		return 0, err
+	}
+	return s.Generator.Next()
+}
+
+// NextN generate n ids. returns ErrLeaseLost if the leased worker id is lost.
+func (s *SnowflakeService) NextN(n int) ([]int64, error) {
+	if err := s.checkLease(); err != nil {
+		return nil, err
+	}
+	return s.Generator.NextN(n)
+}
+
+// check the lease is valid, and use the new worker id if it's leased again.
+func (s *SnowflakeService) checkLease() error {
+	if s.lease == nil {
+		return nil
+	}
+
+	workerId, err := s.lease.Check()
+	if err != nil {
+		return err
+	}
+	if workerId != s.Generator.WorkerId() {
+		return s.Generator.SetWorkerId(workerId)
+	}
+	return nil
+}
+
+// StringService the service generate the 128-bit sortable string ids, by the service type: ulid, uuidv7
+type StringService struct {
+	*strid.Generator
+	serviceMeta
+}
+
+// NewStringService instance
+func NewStringService(store Storage, serviceName, typ string) *StringService {
+	gen := strid.NewULID()
+	if typ == TypeUUIDv7 {
+		gen = strid.NewUUIDv7()
+	}
+
+	return &StringService{
+		Generator: gen,
+		serviceMeta: serviceMeta{
+			store: store,
+			name:  serviceName,
+			opts:  &Options{Type: typ},
+		},
+	}
+}
+
+// Current always returns 0, the string id is not int64.
+func (s *StringService) Current() int64 {
+	return 0
+}
+
+// Next returns ErrStringService, please use NextString
+func (s *StringService) Next() (int64, error) {
+	return 0, ErrStringService
+}
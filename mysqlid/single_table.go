@@ -1,10 +1,135 @@
 package mysqlid
 
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/gookit/slog"
+)
+
+// on single table mode, all services are stored as rows in one table(Config.TableName).
 const (
 	// CreateSingleTableSQL "IF NOT EXISTS"
-	CreateSingleTableSQL = `CREATE TABLE %s (
-    k VARCHAR(128) NOT NULL COMMENT "service name",
-    id bigint(20) unsigned NOT NULL "global id for service",
+	CreateSingleTableSQL = `CREATE TABLE IF NOT EXISTS %s (
+    k VARCHAR(128) NOT NULL COMMENT 'service name',
+    id bigint(20) unsigned NOT NULL DEFAULT 0 COMMENT 'global id for service',
+    options VARCHAR(2048) NOT NULL DEFAULT '' COMMENT 'service options, json',
     PRIMARY KEY (k)
 ) ENGINE=Innodb DEFAULT CHARSET=utf8`
+
+	SelectRowIdSQLFormat        = "SELECT `id` FROM `%s` WHERE `k` = ?"
+	SelectRowForUpdateSQLFormat = "SELECT `id` FROM `%s` WHERE `k` = ? FOR UPDATE"
+	UpdateRowIdSQLFormat        = "UPDATE `%s` SET `id` = `id` + ? WHERE `k` = ?"
+	ResetRowIdSQLFormat         = "UPDATE `%s` SET `id` = ? WHERE `k` = ?"
+	WrapRowIdSQLFormat          = "UPDATE `%s` SET `id` = ? WHERE `k` = ? AND `id` >= ?"
+	InsertRowSQLFormat          = "INSERT INTO `%s` (`k`, `id`) VALUES (?, ?)"
+	DeleteRowSQLFormat          = "DELETE FROM `%s` WHERE `k` = ?"
 )
+
+// SingleTableStorage the MySQL storage on single table mode
+type SingleTableStorage struct {
+	mysqlTable
+}
+
+// NewSingleTableStorage instance
+func NewSingleTableStorage(db *sql.DB, table string) *SingleTableStorage {
+	return &SingleTableStorage{
+		mysqlTable: mysqlTable{db: db, table: table},
+	}
+}
+
+// Init create the table
+func (s *SingleTableStorage) Init() error {
+	createTableSQL := fmt.Sprintf(CreateSingleTableSQL, s.table)
+
+	slog.Infof("SQL=%s", createTableSQL)
+	_, err := s.db.Exec(createTableSQL)
+	return err
+}
+
+// Exists check the service row exists
+func (s *SingleTableStorage) Exists(key string) (bool, error) {
+	_, exists, err := s.getLastIdFromRow(key)
+	return exists, err
+}
+
+// Current get last id from the service row
+func (s *SingleTableStorage) Current(key string) (int64, error) {
+	id, _, err := s.getLastIdFromRow(key)
+	return id, err
+}
+
+// get last id from the service row. returns exists=false on the row not exists.
+func (s *SingleTableStorage) getLastIdFromRow(key string) (id int64, exists bool, err error) {
+	selectRowSQL := fmt.Sprintf(SelectRowIdSQLFormat, s.table)
+
+	slog.Infof("SQL=%s key=%s", selectRowSQL, key)
+	err = s.db.QueryRow(selectRowSQL, key).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	slog.Infof("get last id form db table: %s, key: %s, last: %d", s.table, key, id)
+	return id, true, nil
+}
+
+// Alloc allocate an id range of size for the key
+func (s *SingleTableStorage) Alloc(key string, size int64) (int64, error) {
+	selectForUpdate := fmt.Sprintf(SelectRowForUpdateSQLFormat, s.table)
+	updateIdSql := fmt.Sprintf(UpdateRowIdSQLFormat, s.table)
+
+	return s.allocInTx(key, selectForUpdate, []interface{}{key}, updateIdSql, []interface{}{size, key})
+}
+
+// Wrap reset the id to id by one conditional update, only if the current id is not less than the threshold.
+func (s *SingleTableStorage) Wrap(key string, threshold, id int64) (int64, bool, error) {
+	wrapRowSQL := fmt.Sprintf(WrapRowIdSQLFormat, s.table)
+	wrapped, err := s.wrapByUpdate(wrapRowSQL, id, key, threshold)
+	if err != nil || wrapped {
+		return id, wrapped, err
+	}
+
+	cur, err := s.Current(key)
+	return cur, false, err
+}
+
+// Reset the service row. if the row exists and force=false, will not change the id.
+func (s *SingleTableStorage) Reset(key string, idOffset int64, force bool) (int64, error) {
+	id, exists, err := s.getLastIdFromRow(key)
+	if err != nil {
+		return 0, err
+	}
+
+	// has record. update id to latest.
+	// NOTICE: dont update db id value to `idOffset`.
+	if exists && !force {
+		return id, nil
+	}
+
+	if exists {
+		resetRowSQL := fmt.Sprintf(ResetRowIdSQLFormat, s.table)
+		slog.Infof("SQL=%s key=%s id=%d", resetRowSQL, key, idOffset)
+		_, err = s.db.Exec(resetRowSQL, idOffset, key)
+	} else {
+		insertRowSQL := fmt.Sprintf(InsertRowSQLFormat, s.table)
+		slog.Infof("SQL=%s key=%s id=%d", insertRowSQL, key, idOffset)
+		_, err = s.db.Exec(insertRowSQL, key, idOffset)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+	return idOffset, nil
+}
+
+// Delete the service row
+func (s *SingleTableStorage) Delete(key string) error {
+	deleteRowSQL := fmt.Sprintf(DeleteRowSQLFormat, s.table)
+
+	slog.Infof("SQL=%s key=%s", deleteRowSQL, key)
+	_, err := s.db.Exec(deleteRowSQL, key)
+	return err
+}
@@ -0,0 +1,55 @@
+package mysqlid
+
+import "errors"
+
+// ErrKeyNotExists the key not exists on the storage
+var ErrKeyNotExists = errors.New("key not exists on the storage")
+
+// Storage interface. the persistent backend of the id generator services.
+//
+// the Generator and Manager only depend on it, MySQL is one of the implementations.
+type Storage interface {
+	// Init the storage. eg: create tables
+	Init() error
+	// Keys list all service keys
+	Keys() ([]string, error)
+	// Exists check the service key is exists
+	Exists(key string) (bool, error)
+	// Current read the current max id of the key
+	Current(key string) (int64, error)
+	// Alloc allocate an id range of size for the key, returns the range start. the range is (start, start+size]
+	Alloc(key string, size int64) (int64, error)
+	// Reset create the key with id. if the key exists and force=false, will not change the id.
+	// returns the current max id of the key.
+	Reset(key string, id int64, force bool) (int64, error)
+	// Delete the key
+	Delete(key string) error
+	// Options read the service options of the key
+	Options(key string) (*Options, error)
+	// SaveOptions save the service options of the key
+	SaveOptions(key string, opts *Options) error
+}
+
+// Wrapper the storage can wrap the id of the key in one conditional operation, for the exhausted policy wrap.
+// so only one of the nodes reached the max_id together wraps the id.
+type Wrapper interface {
+	// Wrap reset the id of the key to id, only if the current id is not less than the threshold.
+	// returns the current id after it, and wrapped=true if the id is reset by this call.
+	Wrap(key string, threshold, id int64) (current int64, wrapped bool, err error)
+}
+
+// wrap the id of the key by the Wrapper of the storage.
+// fallback to read and reset the id, if the storage is not a Wrapper.
+func wrapId(store Storage, key string, threshold, id int64) (int64, bool, error) {
+	if w, ok := store.(Wrapper); ok {
+		return w.Wrap(key, threshold, id)
+	}
+
+	cur, err := store.Current(key)
+	if err != nil || cur < threshold {
+		return cur, false, err
+	}
+
+	cur, err = store.Reset(key, id, true)
+	return cur, err == nil, err
+}
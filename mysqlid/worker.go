@@ -0,0 +1,281 @@
+package mysqlid
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gookit/slog"
+)
+
+// ErrLeaseLost the worker id lease is expired or taken by other node
+var ErrLeaseLost = errors.New("the worker id lease is lost")
+
+// WorkerLeaser the storage can lease the unique worker id to the genid nodes.
+// the lease should be renewed before expired, the expired worker id will be reclaimed by other nodes.
+type WorkerLeaser interface {
+	// LeaseWorker lease a free or expired worker id in 0 ~ max for the node
+	LeaseWorker(node string, max int64, ttl time.Duration) (int64, error)
+	// RenewWorker renew the lease. returns ErrLeaseLost if the lease is taken by other node.
+	RenewWorker(workerId int64, node string, ttl time.Duration) error
+	// ReleaseWorker release the worker id
+	ReleaseWorker(workerId int64, node string) error
+}
+
+// the worker lease table is created next to the manager table, named Config.TableName + "_workers"
+const (
+	WorkerTableSuffix = "_workers"
+
+	CreateWorkerTableSQLFormat = `CREATE TABLE IF NOT EXISTS %s (
+    worker_id INT unsigned NOT NULL COMMENT 'snowflake worker id',
+    node VARCHAR(255) NOT NULL DEFAULT '' COMMENT 'the node hold the lease',
+    expire_at bigint(20) NOT NULL DEFAULT 0 COMMENT 'lease expire time, unix milliseconds',
+    PRIMARY KEY (worker_id)
+) ENGINE=Innodb DEFAULT CHARSET=utf8`
+
+	SelectWorkersSQLFormat = "SELECT `worker_id`, `expire_at` FROM `%s` FOR UPDATE"
+	InsertWorkerSQLFormat  = "INSERT INTO `%s` (`worker_id`, `node`, `expire_at`) VALUES (?, ?, ?)"
+	ReclaimWorkerSQLFormat = "UPDATE `%s` SET `node` = ?, `expire_at` = ? WHERE `worker_id` = ? AND `expire_at` < ?"
+	RenewWorkerSQLFormat   = "UPDATE `%s` SET `expire_at` = ? WHERE `worker_id` = ? AND `node` = ?"
+	DeleteWorkerSQLFormat  = "DELETE FROM `%s` WHERE `worker_id` = ? AND `node` = ?"
+)
+
+func (t *mysqlTable) workerTable() string {
+	return t.table + WorkerTableSuffix
+}
+
+// LeaseWorker lease a free or expired worker id from the worker table
+func (t *mysqlTable) LeaseWorker(node string, max int64, ttl time.Duration) (int64, error) {
+	createTableSQL := fmt.Sprintf(CreateWorkerTableSQLFormat, t.workerTable())
+
+	slog.Infof("SQL=%s", createTableSQL)
+	if _, err := t.db.Exec(createTableSQL); err != nil {
+		return 0, err
+	}
+
+	tx, err := t.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	workerId, err := t.leaseWorkerInTx(tx, node, max, ttl)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return workerId, nil
+}
+
+func (t *mysqlTable) leaseWorkerInTx(tx *sql.Tx, node string, max int64, ttl time.Duration) (int64, error) {
+	table := t.workerTable()
+	selectSQL := fmt.Sprintf(SelectWorkersSQLFormat, table)
+
+	// lock all workers, the table is small.
+	slog.Infof("SQL=%s", selectSQL)
+	rows, err := tx.Query(selectSQL)
+	if err != nil {
+		return 0, err
+	}
+
+	now := unixMillis(time.Now())
+	expired := int64(-1)
+	used := make(map[int64]bool)
+	for rows.Next() {
+		var workerId, expireAt int64
+		if err = rows.Scan(&workerId, &expireAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		used[workerId] = true
+		if expireAt < now && expired < 0 && workerId <= max {
+			expired = workerId
+		}
+	}
+	rows.Close()
+
+	expireAt := now + int64(ttl/time.Millisecond)
+	for workerId := int64(0); workerId <= max; workerId++ {
+		if used[workerId] {
+			continue
+		}
+
+		insertSQL := fmt.Sprintf(InsertWorkerSQLFormat, table)
+		slog.Infof("SQL=%s worker_id=%d node=%s", insertSQL, workerId, node)
+		_, err = tx.Exec(insertSQL, workerId, node, expireAt)
+		return workerId, err
+	}
+
+	// reclaim the expired worker id of dead node
+	if expired < 0 {
+		return 0, fmt.Errorf("no free worker id in 0 ~ %d", max)
+	}
+
+	reclaimSQL := fmt.Sprintf(ReclaimWorkerSQLFormat, table)
+	slog.Infof("SQL=%s worker_id=%d node=%s", reclaimSQL, expired, node)
+	_, err = tx.Exec(reclaimSQL, node, expireAt, expired, now)
+	return expired, err
+}
+
+// RenewWorker renew the lease of the worker id
+func (t *mysqlTable) RenewWorker(workerId int64, node string, ttl time.Duration) error {
+	renewSQL := fmt.Sprintf(RenewWorkerSQLFormat, t.workerTable())
+	expireAt := unixMillis(time.Now().Add(ttl))
+
+	slog.Debugf("SQL=%s worker_id=%d node=%s", renewSQL, workerId, node)
+	ret, err := t.db.Exec(renewSQL, expireAt, workerId, node)
+	if err != nil {
+		return err
+	}
+
+	if n, err := ret.RowsAffected(); err != nil || n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// ReleaseWorker delete the worker id lease
+func (t *mysqlTable) ReleaseWorker(workerId int64, node string) error {
+	deleteSQL := fmt.Sprintf(DeleteWorkerSQLFormat, t.workerTable())
+
+	slog.Infof("SQL=%s worker_id=%d node=%s", deleteSQL, workerId, node)
+	_, err := t.db.Exec(deleteSQL, workerId, node)
+	return err
+}
+
+func unixMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// workerLease hold the leased worker id, and renew it on background.
+type workerLease struct {
+	store WorkerLeaser
+	node  string
+	max   int64
+	ttl   time.Duration
+
+	lock     sync.RWMutex
+	workerId int64
+	expireAt time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// lease a worker id from the storage, and start the heartbeat
+func leaseWorker(store WorkerLeaser, max int64, ttl time.Duration) (*workerLease, error) {
+	host, _ := os.Hostname()
+	// the node name is unique on each process
+	node := fmt.Sprintf("%s-%d-%d", host, os.Getpid(), time.Now().UnixNano())
+
+	start := time.Now()
+	workerId, err := store.LeaseWorker(node, max, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &workerLease{
+		store:    store,
+		node:     node,
+		max:      max,
+		workerId: workerId,
+		ttl:      ttl,
+		expireAt: start.Add(ttl),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	slog.Infof("leased the worker id %d for the node %s", workerId, node)
+	go l.heartbeat()
+	return l, nil
+}
+
+// renew the lease 3 times per ttl
+func (l *workerLease) heartbeat() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if err := l.renew(); err != nil {
+				slog.Errorf("renew the worker id %d lease error: %s", l.WorkerId(), err.Error())
+			}
+		}
+	}
+}
+
+// renew the lease. if the lease is lost, the worker id maybe taken by other node,
+// lease a new free worker id and swap it in.
+func (l *workerLease) renew() error {
+	start := time.Now()
+	workerId := l.WorkerId()
+
+	err := l.store.RenewWorker(workerId, l.node, l.ttl)
+	if err == ErrLeaseLost {
+		l.setExpireAt(time.Time{})
+
+		workerId, err = l.store.LeaseWorker(l.node, l.max, l.ttl)
+		if err != nil {
+			return err
+		}
+		slog.Warnf("the worker id lease is lost, leased the new worker id %d for the node %s", workerId, l.node)
+	}
+	if err != nil {
+		return err
+	}
+
+	l.lock.Lock()
+	l.workerId = workerId
+	l.expireAt = start.Add(l.ttl)
+	l.lock.Unlock()
+	return nil
+}
+
+func (l *workerLease) setExpireAt(t time.Time) {
+	l.lock.Lock()
+	l.expireAt = t
+	l.lock.Unlock()
+}
+
+// WorkerId get the leased worker id, it's changed after the lease lost and leased again.
+func (l *workerLease) WorkerId() int64 {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return l.workerId
+}
+
+// Check the lease is valid, returns the leased worker id.
+// the worker id maybe reclaimed by other node after the lease expired.
+func (l *workerLease) Check() (int64, error) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	if time.Now().Before(l.expireAt) {
+		return l.workerId, nil
+	}
+	return 0, ErrLeaseLost
+}
+
+// Close stop the heartbeat, and release the worker id
+func (l *workerLease) Close() error {
+	close(l.stop)
+	<-l.done
+
+	l.setExpireAt(time.Time{})
+	workerId := l.WorkerId()
+	slog.Infof("release the worker id %d of the node %s", workerId, l.node)
+	return l.store.ReleaseWorker(workerId, l.node)
+}
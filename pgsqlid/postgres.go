@@ -0,0 +1,516 @@
+package pgsqlid
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gookit/slog"
+	"github.com/inherelab/genid/mysqlid"
+	"github.com/lib/pq"
+)
+
+// the allocate modes
+const (
+	// ModeRow allocate segment by "SELECT ... FOR UPDATE" on the counter row of the key table
+	ModeRow = "row"
+	// ModeSequence allocate segment by nextval() on the key sequence, the INCREMENT equals the batch count
+	ModeSequence = "sequence"
+)
+
+const (
+	// create the record table, same as mysqlid.CreateRecordTableNTSQLFormat
+	CreateRecordTableSQLFormat = `CREATE TABLE IF NOT EXISTS %s (
+    k VARCHAR(255) NOT NULL PRIMARY KEY,
+    options VARCHAR(2048) NOT NULL DEFAULT ''
+)`
+
+	// create the counter table for the key, like mysqlid.CreateTableNTSQLFormat.
+	// the column one is the singleton key, so the table only has one row on concurrent reset.
+	CreateTableSQLFormat = `CREATE TABLE IF NOT EXISTS %s (
+    one BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (one),
+    id BIGINT NOT NULL DEFAULT 0
+)`
+
+	CreateSequenceSQLFormat = "CREATE SEQUENCE IF NOT EXISTS %s MINVALUE 0"
+	AlterSequenceSQLFormat  = "ALTER SEQUENCE %s INCREMENT BY %d"
+	NextvalSQL              = "SELECT nextval($1::regclass)"
+	SetvalSQL               = "SELECT setval($1::regclass, $2, true)"
+	SequenceExistsSQL       = "SELECT to_regclass($1)::text"
+	LastValueSQLFormat      = "SELECT last_value FROM %s"
+	DropSequenceSQLFormat   = "DROP SEQUENCE IF EXISTS %s"
+
+	DropTableSQLFormat     = "DROP TABLE IF EXISTS %s"
+	SelectIdSQLFormat      = "SELECT id FROM %s"
+	SelectForUpdateSQL     = "SELECT id FROM %s FOR UPDATE"
+	UpdateIdSQLFormat      = "UPDATE %s SET id = id + $1"
+	WrapIdSQLFormat        = "UPDATE %s SET id = $1 WHERE id >= $2"
+	InsertIdSQLFormat      = "INSERT INTO %s (id) VALUES ($1) ON CONFLICT (one) DO NOTHING"
+	UpsertIdSQLFormat      = "INSERT INTO %s (id) VALUES ($1) ON CONFLICT (one) DO UPDATE SET id = EXCLUDED.id"
+	InsertKeySQLFormat     = "INSERT INTO %s (k) VALUES ($1) ON CONFLICT (k) DO NOTHING"
+	SelectKeySQLFormat     = "SELECT k FROM %s WHERE k = $1"
+	SelectKeysSQLFormat    = "SELECT k FROM %s"
+	DeleteKeySQLFormat     = "DELETE FROM %s WHERE k = $1"
+	SelectOptionsSQLFormat = "SELECT options FROM %s WHERE k = $1"
+	UpdateOptionsSQLFormat = "UPDATE %s SET options = $1 WHERE k = $2"
+
+	// create the range lease table, named table + mysqlid.LeaseTableSuffix. same as mysqlid.CreateLeaseTableSQLFormat
+	CreateLeaseTableSQLFormat = `CREATE TABLE IF NOT EXISTS %s (
+    id BIGSERIAL PRIMARY KEY,
+    k VARCHAR(255) NOT NULL,
+    client VARCHAR(255) NOT NULL DEFAULT '',
+    start_id BIGINT NOT NULL,
+    end_id BIGINT NOT NULL,
+    step BIGINT NOT NULL DEFAULT 1,
+    used BIGINT NOT NULL DEFAULT 0,
+    created_at BIGINT NOT NULL DEFAULT 0,
+    reported_at BIGINT NOT NULL DEFAULT 0
+)`
+	CreateLeaseIndexSQLFormat = "CREATE INDEX IF NOT EXISTS %s ON %s (k)"
+
+	InsertLeaseSQLFormat = "INSERT INTO %s (k, client, start_id, end_id, step, created_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id"
+	ReportLeaseSQLFormat = "UPDATE %s SET used = $1, reported_at = $2 WHERE id = $3"
+	SelectLeaseSQLFormat = "SELECT id, k, client, start_id, end_id, step, used, created_at, reported_at FROM %s WHERE k = $1 ORDER BY id"
+)
+
+// Config for the PostgreSQL storage. the connection settings use the mysqlid.DBConfig
+type Config struct {
+	// Mode the allocate mode. allow: row, sequence. default is row
+	Mode string `mapstructure:"mode" yaml:"mode"`
+	// SSLMode the sslmode of DSN. default is disable
+	SSLMode string `mapstructure:"ssl_mode" yaml:"ssl_mode"`
+}
+
+// escape the quoted value of DSN
+var dsnEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// DSN build the lib/pq DSN from db config
+func DSN(c *mysqlid.DBConfig, sslMode string) string {
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+
+	// eg: "host=127.0.0.1 port=5432 user=postgres password='' dbname=test sslmode=disable"
+	return fmt.Sprintf("host=%s port=%d user=%s password='%s' dbname=%s sslmode=%s",
+		c.Host,
+		c.Port,
+		c.User,
+		dsnEscaper.Replace(c.Password),
+		c.DBName,
+		sslMode,
+	)
+}
+
+// OpenDB open the PostgreSQL connection
+func OpenDB(c *mysqlid.DBConfig, sslMode string) (*sql.DB, error) {
+	slog.Infof("init PostgreSQL DB connection, host:%s db:%s", c.Host, c.DBName)
+
+	db, err := sql.Open("postgres", DSN(c, sslMode))
+	if err != nil {
+		return nil, err
+	}
+
+	if c.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(c.MaxIdleConns)
+	}
+	return db, nil
+}
+
+// Storage the PostgreSQL storage.
+// all keys are recorded on the record table, each key has a counter table or a sequence named prefix + key.
+type Storage struct {
+	db   *sql.DB
+	mode string
+	// the record table name
+	table string
+	// the prefix of key table or sequence
+	prefix string
+	// the table name of the range leases, without quoted
+	leaseTable string
+}
+
+var (
+	_ mysqlid.Storage     = (*Storage)(nil)
+	_ mysqlid.RangeLeaser = (*Storage)(nil)
+)
+
+// NewStorage instance
+func NewStorage(db *sql.DB, mode, table, prefix string) (*Storage, error) {
+	if mode == "" {
+		mode = ModeRow
+	}
+
+	if mode != ModeRow && mode != ModeSequence {
+		return nil, fmt.Errorf("postgres: invalid allocate mode %q", mode)
+	}
+
+	return &Storage{
+		db:         db,
+		mode:       mode,
+		table:      pq.QuoteIdentifier(table),
+		prefix:     prefix,
+		leaseTable: table + mysqlid.LeaseTableSuffix,
+	}, nil
+}
+
+// DB get the sql db
+func (s *Storage) DB() *sql.DB {
+	return s.db
+}
+
+// the quoted counter table or sequence name of the key
+func (s *Storage) keyObject(key string) string {
+	return pq.QuoteIdentifier(s.prefix + key)
+}
+
+// Init create the record table and the lease table
+func (s *Storage) Init() error {
+	leaseTable := pq.QuoteIdentifier(s.leaseTable)
+	sqlList := []string{
+		fmt.Sprintf(CreateRecordTableSQLFormat, s.table),
+		fmt.Sprintf(CreateLeaseTableSQLFormat, leaseTable),
+		fmt.Sprintf(CreateLeaseIndexSQLFormat, pq.QuoteIdentifier(s.leaseTable+"_k"), leaseTable),
+	}
+
+	for _, createSQL := range sqlList {
+		slog.Infof("SQL=%s", createSQL)
+		if _, err := s.db.Exec(createSQL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Keys list all service keys
+func (s *Storage) Keys() ([]string, error) {
+	selectKeysSQL := fmt.Sprintf(SelectKeysSQLFormat, s.table)
+
+	slog.Infof("SQL=%s", selectKeysSQL)
+	rows, err := s.db.Query(selectKeysSQL)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		key := ""
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// Exists check the key is recorded
+func (s *Storage) Exists(key string) (bool, error) {
+	var name string
+	selectKeySQL := fmt.Sprintf(SelectKeySQLFormat, s.table)
+
+	slog.Debugf("SQL=%s key=%s", selectKeySQL, key)
+	err := s.db.QueryRow(selectKeySQL, key).Scan(&name)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Current get last id of the key
+func (s *Storage) Current(key string) (int64, error) {
+	var id int64
+	selectIdSQL := fmt.Sprintf(SelectIdSQLFormat, s.keyObject(key))
+	if s.mode == ModeSequence {
+		selectIdSQL = fmt.Sprintf(LastValueSQLFormat, s.keyObject(key))
+	}
+
+	slog.Debugf("SQL=%s", selectIdSQL)
+	err := s.db.QueryRow(selectIdSQL).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// Alloc allocate an id range of size for the key. returns the range start
+func (s *Storage) Alloc(key string, size int64) (int64, error) {
+	if s.mode == ModeSequence {
+		return s.allocBySequence(key, size)
+	}
+
+	var id int64
+	table := s.keyObject(key)
+	selectForUpdate := fmt.Sprintf(SelectForUpdateSQL, table)
+	updateIdSQL := fmt.Sprintf(UpdateIdSQLFormat, table)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	slog.Infof("SQL=%s", selectForUpdate)
+	err = tx.QueryRow(selectForUpdate).Scan(&id)
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("%s: have no id name", key)
+		}
+		return 0, err
+	}
+
+	slog.Infof("dbId=%d SQL=%s size=%d", id, updateIdSQL, size)
+	if _, err = tx.Exec(updateIdSQL, size); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// NOTICE: ALTER SEQUENCE blocks the concurrent nextval() until the transaction commit,
+// so the nextval() in the same transaction always increment by the size.
+func (s *Storage) allocBySequence(key string, size int64) (int64, error) {
+	var last int64
+	seq := s.keyObject(key)
+	alterSQL := fmt.Sprintf(AlterSequenceSQLFormat, seq, size)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	slog.Infof("SQL=%s", alterSQL)
+	if _, err = tx.Exec(alterSQL); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	slog.Infof("SQL=%s seq=%s", NextvalSQL, seq)
+	if err = tx.QueryRow(NextvalSQL, seq).Scan(&last); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	// the range is (last-size, last]
+	return last - size, nil
+}
+
+// Wrap reset the id to id by one conditional update, only if the current id is not less than the threshold.
+func (s *Storage) Wrap(key string, threshold, id int64) (int64, bool, error) {
+	if s.mode == ModeSequence {
+		return s.wrapSequence(key, threshold, id)
+	}
+
+	wrapIdSQL := fmt.Sprintf(WrapIdSQLFormat, s.keyObject(key))
+	slog.Infof("SQL=%s id=%d threshold=%d", wrapIdSQL, id, threshold)
+	ret, err := s.db.Exec(wrapIdSQL, id, threshold)
+	if err != nil {
+		return 0, false, err
+	}
+
+	n, err := ret.RowsAffected()
+	if err != nil || n > 0 {
+		return id, n > 0, err
+	}
+
+	cur, err := s.Current(key)
+	return cur, false, err
+}
+
+// NOTICE: the ALTER SEQUENCE locks the sequence like allocBySequence,
+// so the last_value can't be changed by others before the setval.
+func (s *Storage) wrapSequence(key string, threshold, id int64) (int64, bool, error) {
+	var last int64
+	seq := s.keyObject(key)
+	alterSQL := fmt.Sprintf(AlterSequenceSQLFormat, seq, 1)
+	lastValueSQL := fmt.Sprintf(LastValueSQLFormat, seq)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, false, err
+	}
+
+	slog.Infof("SQL=%s", alterSQL)
+	if _, err = tx.Exec(alterSQL); err != nil {
+		tx.Rollback()
+		return 0, false, err
+	}
+
+	if err = tx.QueryRow(lastValueSQL).Scan(&last); err != nil {
+		tx.Rollback()
+		return 0, false, err
+	}
+
+	if last < threshold {
+		return last, false, tx.Commit()
+	}
+
+	slog.Infof("SQL=%s seq=%s id=%d", SetvalSQL, seq, id)
+	if _, err = tx.Exec(SetvalSQL, seq, id); err != nil {
+		tx.Rollback()
+		return 0, false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, false, err
+	}
+	return id, true, nil
+}
+
+// Reset create the key counter table or sequence, and record the key.
+// if the key exists and force=false, will not change the id.
+func (s *Storage) Reset(key string, idOffset int64, force bool) (int64, error) {
+	insertKeySQL := fmt.Sprintf(InsertKeySQLFormat, s.table)
+
+	slog.Infof("SQL=%s key=%s", insertKeySQL, key)
+	if _, err := s.db.Exec(insertKeySQL, key); err != nil {
+		return 0, err
+	}
+
+	if s.mode == ModeSequence {
+		return s.resetSequence(key, idOffset, force)
+	}
+
+	table := s.keyObject(key)
+	createTableSQL := fmt.Sprintf(CreateTableSQLFormat, table)
+
+	slog.Infof("SQL=%s", createTableSQL)
+	if _, err := s.db.Exec(createTableSQL); err != nil {
+		return 0, err
+	}
+
+	if force {
+		upsertIdSQL := fmt.Sprintf(UpsertIdSQLFormat, table)
+		slog.Infof("SQL=%s id=%d", upsertIdSQL, idOffset)
+		if _, err := s.db.Exec(upsertIdSQL, idOffset); err != nil {
+			return 0, err
+		}
+		return idOffset, nil
+	}
+
+	// NOTICE: dont update db id value to `idOffset` if the row exists.
+	insertIdSQL := fmt.Sprintf(InsertIdSQLFormat, table)
+	slog.Infof("SQL=%s id=%d", insertIdSQL, idOffset)
+	if _, err := s.db.Exec(insertIdSQL, idOffset); err != nil {
+		return 0, err
+	}
+	return s.Current(key)
+}
+
+func (s *Storage) resetSequence(key string, idOffset int64, force bool) (int64, error) {
+	seq := s.keyObject(key)
+
+	// to_regclass returns NULL on not exists
+	var seqName sql.NullString
+	err := s.db.QueryRow(SequenceExistsSQL, seq).Scan(&seqName)
+	if err != nil {
+		return 0, err
+	}
+
+	// NOTICE: dont update db id value to `idOffset`.
+	if seqName.Valid && !force {
+		return s.Current(key)
+	}
+
+	createSeqSQL := fmt.Sprintf(CreateSequenceSQLFormat, seq)
+	slog.Infof("SQL=%s", createSeqSQL)
+	if _, err = s.db.Exec(createSeqSQL); err != nil {
+		return 0, err
+	}
+
+	slog.Infof("SQL=%s seq=%s id=%d", SetvalSQL, seq, idOffset)
+	if _, err = s.db.Exec(SetvalSQL, seq, idOffset); err != nil {
+		return 0, err
+	}
+	return idOffset, nil
+}
+
+// Delete drop the key counter table or sequence, and delete the key record
+func (s *Storage) Delete(key string) error {
+	dropSQL := fmt.Sprintf(DropTableSQLFormat, s.keyObject(key))
+	if s.mode == ModeSequence {
+		dropSQL = fmt.Sprintf(DropSequenceSQLFormat, s.keyObject(key))
+	}
+
+	slog.Infof("SQL=%s", dropSQL)
+	if _, err := s.db.Exec(dropSQL); err != nil {
+		return err
+	}
+
+	deleteKeySQL := fmt.Sprintf(DeleteKeySQLFormat, s.table)
+	slog.Infof("SQL=%s key=%s", deleteKeySQL, key)
+	_, err := s.db.Exec(deleteKeySQL, key)
+	return err
+}
+
+// Options get service options of the key
+func (s *Storage) Options(key string) (*mysqlid.Options, error) {
+	var str string
+	selectOptionsSQL := fmt.Sprintf(SelectOptionsSQLFormat, s.table)
+
+	slog.Debugf("SQL=%s key=%s", selectOptionsSQL, key)
+	err := s.db.QueryRow(selectOptionsSQL, key).Scan(&str)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	return mysqlid.ParseOptions(str)
+}
+
+// SaveOptions save service options of the key
+func (s *Storage) SaveOptions(key string, opts *mysqlid.Options) error {
+	updateOptionsSQL := fmt.Sprintf(UpdateOptionsSQLFormat, s.table)
+
+	slog.Infof("SQL=%s key=%s options=%s", updateOptionsSQL, key, opts.String())
+	_, err := s.db.Exec(updateOptionsSQL, opts.String(), key)
+	return err
+}
+
+// SaveLease record the leased range
+func (s *Storage) SaveLease(lease *mysqlid.RangeLease) error {
+	insertSQL := fmt.Sprintf(InsertLeaseSQLFormat, pq.QuoteIdentifier(s.leaseTable))
+
+	slog.Infof("SQL=%s key=%s client=%s range=[%d, %d]", insertSQL, lease.Key, lease.Client, lease.Start, lease.End)
+	return s.db.QueryRow(insertSQL, lease.Key, lease.Client, lease.Start, lease.End, lease.Step, lease.CreatedAt.Unix()).
+		Scan(&lease.Id)
+}
+
+// ReportLease update the consumed count of the lease
+func (s *Storage) ReportLease(id, used int64) error {
+	reportSQL := fmt.Sprintf(ReportLeaseSQLFormat, pq.QuoteIdentifier(s.leaseTable))
+
+	slog.Infof("SQL=%s id=%d used=%d", reportSQL, id, used)
+	ret, err := s.db.Exec(reportSQL, used, time.Now().Unix(), id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := ret.RowsAffected(); err == nil && n == 0 {
+		return mysqlid.ErrLeaseNotExists
+	}
+	return nil
+}
+
+// Leases list the range leases of the key
+func (s *Storage) Leases(key string) ([]*mysqlid.RangeLease, error) {
+	selectSQL := fmt.Sprintf(SelectLeaseSQLFormat, pq.QuoteIdentifier(s.leaseTable))
+
+	slog.Infof("SQL=%s key=%s", selectSQL, key)
+	rows, err := s.db.Query(selectSQL, key)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	return mysqlid.ScanLeases(rows)
+}
@@ -0,0 +1,129 @@
+package pgsqlid_test
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/inherelab/genid/idtest"
+	"github.com/inherelab/genid/mysqlid"
+	"github.com/inherelab/genid/pgsqlid"
+	"github.com/lib/pq"
+)
+
+// the env var of the PostgreSQL dsn for the storage tests.
+// eg: "host=127.0.0.1 port=5432 user=postgres dbname=test sslmode=disable"
+const testPostgresEnv = "GENID_TEST_POSTGRES_DSN"
+
+func TestDSN(t *testing.T) {
+	c := &mysqlid.DBConfig{Host: "127.0.0.1", Port: 5432, User: "postgres", Password: `p'a\ss`, DBName: "test"}
+
+	want := `host=127.0.0.1 port=5432 user=postgres password='p\'a\\ss' dbname=test sslmode=disable`
+	if dsn := pgsqlid.DSN(c, ""); dsn != want {
+		t.Fatalf("the dsn should be %q, but got %q", want, dsn)
+	}
+	if dsn := pgsqlid.DSN(c, "require"); !strings.HasSuffix(dsn, " sslmode=require") {
+		t.Fatalf("the sslmode should be require, got %q", dsn)
+	}
+}
+
+func TestNewStorage(t *testing.T) {
+	if _, err := pgsqlid.NewStorage(nil, "unknown", "gid_keys", ""); err == nil {
+		t.Fatal("should returns error on invalid allocate mode")
+	}
+	if _, err := pgsqlid.NewStorage(nil, "", "gid_keys", ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// open the PostgreSQL by the dsn of the testPostgresEnv, skip the test if it's not set.
+func testDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv(testPostgresEnv)
+	if dsn == "" {
+		t.Skip("skip the PostgreSQL test: the env " + testPostgresEnv + " is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err == nil {
+		err = db.Ping()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// create the storage on the tables of this run, drop them on the test finished.
+// the key tables or sequences are named table + "_" + key.
+func testStorage(db *sql.DB, mode string) (idtest.StorageFactory, string, func()) {
+	table := fmt.Sprintf("idtest_%s_%d", mode, time.Now().UnixNano())
+	open := func(t *testing.T) mysqlid.Storage {
+		store, err := pgsqlid.NewStorage(db, mode, table, table+"_")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	}
+
+	cleanup := func() {
+		store, _ := pgsqlid.NewStorage(db, mode, table, table+"_")
+		keys, _ := store.Keys()
+		for _, key := range keys {
+			_ = store.Delete(key)
+		}
+		_, _ = db.Exec(fmt.Sprintf(pgsqlid.DropTableSQLFormat, table))
+		_, _ = db.Exec(fmt.Sprintf(pgsqlid.DropTableSQLFormat, table+mysqlid.LeaseTableSuffix))
+	}
+	return open, table, cleanup
+}
+
+func TestStorage(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	for _, mode := range []string{pgsqlid.ModeRow, pgsqlid.ModeSequence} {
+		t.Run(mode, func(t *testing.T) {
+			open, _, cleanup := testStorage(db, mode)
+			defer cleanup()
+
+			idtest.RunStorage(t, open)
+		})
+	}
+}
+
+func TestStorage_singleRow(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	open, table, cleanup := testStorage(db, pgsqlid.ModeRow)
+	defer cleanup()
+
+	store := open(t)
+	if err := store.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the concurrent reset of a new key should create only one counter row
+	key := "single_row"
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _ = store.Reset(key, int64(i*100), i%2 == 0)
+		}(i)
+	}
+	wg.Wait()
+
+	var rows int
+	if err := db.QueryRow("SELECT count(*) FROM " + pq.QuoteIdentifier(table+"_"+key)).Scan(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 1 {
+		t.Fatalf("the counter table should have one row, but got %d", rows)
+	}
+}
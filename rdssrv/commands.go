@@ -3,13 +3,11 @@ package rdssrv
 import (
 	"strconv"
 
+	"github.com/gookit/goutil/strutil"
 	"github.com/inherelab/genid/mysqlid"
 )
 
 func (s *Server) handleGet(r *Request) Reply {
-	var id int64
-	var err error
-
 	if r.HasArgument(0) == false {
 		return ErrNotEnoughArgs
 	}
@@ -38,7 +36,7 @@ func (s *Server) handleGet(r *Request) Reply {
 	// 	}
 	// }
 
-	id, err = s.NextId(serviceKey)
+	idStr, err := s.NextString(serviceKey)
 	if err != nil {
 		// service not exists
 		if err == mysqlid.ErrServiceNotExists {
@@ -52,12 +50,353 @@ func (s *Server) handleGet(r *Request) Reply {
 		}
 	}
 
-	idStr := strconv.FormatInt(id, 10)
 	return &BulkReply{
 		value: []byte(idStr),
 	}
 }
 
+// redis command(getf abc [template]), returns the next id formatted by the template or the service option FORMAT
+func (s *Server) handleGetFormatted(r *Request) Reply {
+	serviceKey, errReply := r.GetString(0)
+	if errReply != nil {
+		return errReply
+	}
+
+	var tpl string
+	if r.HasArgument(1) {
+		tpl = string(r.Arguments[1])
+	}
+	if len(r.Arguments) > 2 {
+		return ErrTooMuchArgs
+	}
+
+	_, idStr, err := s.NextFormatted(serviceKey, tpl)
+	if err != nil {
+		// service not exists
+		if err == mysqlid.ErrServiceNotExists {
+			return &BulkReply{
+				value: nil,
+			}
+		}
+
+		return &ErrorReply{
+			message: err.Error(),
+		}
+	}
+
+	return &BulkReply{
+		value: []byte(idStr),
+	}
+}
+
+// redis command(getenc abc), returns the next id encoded by the service options SALT, ALPHABET, MIN_LENGTH
+func (s *Server) handleGetEncoded(r *Request) Reply {
+	serviceKey, errReply := r.GetString(0)
+	if errReply != nil {
+		return errReply
+	}
+	if len(r.Arguments) > 1 {
+		return ErrTooMuchArgs
+	}
+
+	_, idStr, err := s.NextEncoded(serviceKey)
+	if err != nil {
+		// service not exists
+		if err == mysqlid.ErrServiceNotExists {
+			return &BulkReply{
+				value: nil,
+			}
+		}
+
+		return &ErrorReply{
+			message: err.Error(),
+		}
+	}
+
+	return &BulkReply{
+		value: []byte(idStr),
+	}
+}
+
+// redis command(decode abc gY), decode the encoded id to the integer
+func (s *Server) handleDecode(r *Request) Reply {
+	serviceKey, errReply := r.GetString(0)
+	if errReply != nil {
+		return errReply
+	}
+
+	idStr, errReply := r.GetString(1)
+	if errReply != nil {
+		return errReply
+	}
+	if len(r.Arguments) > 2 {
+		return ErrTooMuchArgs
+	}
+
+	id, err := s.DecodeId(serviceKey, idStr)
+	if err != nil {
+		return &ErrorReply{
+			message: err.Error(),
+		}
+	}
+
+	return &IntReply{
+		number: id,
+	}
+}
+
+// redis command(incr abc), allocate the next id like GET, returns the integer. returns nil if the key not exists.
+func (s *Server) handleIncr(r *Request) Reply {
+	serviceKey, errReply := r.GetString(0)
+	if errReply != nil {
+		return errReply
+	}
+	if len(r.Arguments) > 1 {
+		return ErrTooMuchArgs
+	}
+
+	return s.incrBy(serviceKey, 1)
+}
+
+// redis command(incrby abc 100), reserve 100 contiguous ids, returns the last one.
+func (s *Server) handleIncrBy(r *Request) Reply {
+	serviceKey, errReply := r.GetString(0)
+	if errReply != nil {
+		return errReply
+	}
+
+	count, errReply := r.GetInt(1)
+	if errReply != nil {
+		return errReply
+	}
+	if count < 1 {
+		return ErrExpectPositivInteger
+	}
+	if len(r.Arguments) > 2 {
+		return ErrTooMuchArgs
+	}
+
+	return s.incrBy(serviceKey, count)
+}
+
+func (s *Server) incrBy(serviceKey string, n int64) Reply {
+	serviceKey, err := mysqlid.GoodServiceKey(serviceKey)
+	if err != nil {
+		return &ErrorReply{err.Error()}
+	}
+
+	id, err := s.IncrBy(serviceKey, n)
+	if err != nil {
+		// service not exists
+		if err == mysqlid.ErrServiceNotExists {
+			return &BulkReply{
+				value: nil,
+			}
+		}
+
+		return &ErrorReply{
+			message: err.Error(),
+		}
+	}
+
+	return &IntReply{
+		number: id,
+	}
+}
+
+// redis command(mgetids abc 100), returns the multi bulk of n ids
+func (s *Server) handleMGetIds(r *Request) Reply {
+	serviceKey, errReply := r.GetString(0)
+	if errReply != nil {
+		return errReply
+	}
+
+	count, errReply := r.GetInt(1)
+	if errReply != nil {
+		return errReply
+	}
+	if count < 1 {
+		return ErrExpectPositivInteger
+	}
+	if len(r.Arguments) > 2 {
+		return ErrTooMuchArgs
+	}
+
+	ids, err := s.NextStrings(serviceKey, int(count))
+	if err != nil {
+		// service not exists
+		if err == mysqlid.ErrServiceNotExists {
+			return &BulkReply{
+				value: nil,
+			}
+		}
+
+		return &ErrorReply{
+			message: err.Error(),
+		}
+	}
+
+	values := make([][]byte, len(ids))
+	for i, id := range ids {
+		values[i] = []byte(id)
+	}
+
+	return &MultiBulkReply{
+		values: values,
+	}
+}
+
+// redis command(mget abc def), returns the multi bulk of the next id of each service, nil for the missing services
+func (s *Server) handleMGet(r *Request) Reply {
+	if !r.HasArgument(0) {
+		return ErrNotEnoughArgs
+	}
+
+	// check all keys before allocate, so the ids of the former keys are not used up on the error
+	exists := make([]bool, len(r.Arguments))
+	for i, arg := range r.Arguments {
+		if len(arg) == 0 {
+			return ErrNoKey
+		}
+
+		_, err := s.GetGenerator(string(arg))
+		if err != nil && err != mysqlid.ErrServiceNotExists {
+			return &ErrorReply{
+				message: err.Error(),
+			}
+		}
+		exists[i] = err == nil
+	}
+
+	values := make([][]byte, len(r.Arguments))
+	for i, arg := range r.Arguments {
+		// service not exists
+		if !exists[i] {
+			continue
+		}
+
+		idStr, err := s.NextString(string(arg))
+		if err != nil {
+			// service is deleted after checked
+			if err == mysqlid.ErrServiceNotExists {
+				continue
+			}
+
+			return &ErrorReply{
+				message: err.Error(),
+			}
+		}
+
+		values[i] = []byte(idStr)
+	}
+
+	return &MultiBulkReply{
+		values: values,
+	}
+}
+
+// redis command(mset abc 12 def 34), set the ids of multi services like SET without force,
+// the id of the existing service is not changed. replies OK like redis, the duplicate key uses the last value.
+func (s *Server) handleMSet(r *Request) Reply {
+	if len(r.Arguments) == 0 {
+		return ErrExpectMorePair
+	}
+	if len(r.Arguments)%2 != 0 {
+		return ErrExpectEvenPair
+	}
+
+	// check all pairs before set
+	kvMap := make(map[string]int64, len(r.Arguments)/2)
+	for i := 0; i < len(r.Arguments); i += 2 {
+		serviceName, err := mysqlid.GoodServiceKey(string(r.Arguments[i]))
+		if err != nil {
+			return &ErrorReply{err.Error()}
+		}
+
+		idValue, errReply := r.GetInt(i + 1)
+		if errReply != nil {
+			return errReply
+		}
+
+		kvMap[serviceName] = idValue
+	}
+
+	if _, err := s.SetMultiServices(kvMap, false); err != nil {
+		return &ErrorReply{
+			message: err.Error(),
+		}
+	}
+
+	return &StatusReply{
+		code: "OK",
+	}
+}
+
+// redis command(lease abc 10000 [client]), returns the multi bulk of [lease id, start, end]
+func (s *Server) handleLease(r *Request) Reply {
+	serviceKey, errReply := r.GetString(0)
+	if errReply != nil {
+		return errReply
+	}
+
+	count, errReply := r.GetInt(1)
+	if errReply != nil {
+		return errReply
+	}
+	if count < 1 {
+		return ErrExpectPositivInteger
+	}
+
+	var client string
+	if r.HasArgument(2) {
+		client = string(r.Arguments[2])
+	}
+	if len(r.Arguments) > 3 {
+		return ErrTooMuchArgs
+	}
+
+	lease, err := s.LeaseRange(serviceKey, client, count)
+	if err != nil {
+		return &ErrorReply{
+			message: err.Error(),
+		}
+	}
+
+	return &MultiBulkReply{
+		values: [][]byte{
+			[]byte(strconv.FormatInt(lease.Id, 10)),
+			[]byte(strconv.FormatInt(lease.Start, 10)),
+			[]byte(strconv.FormatInt(lease.End, 10)),
+		},
+	}
+}
+
+// redis command(leasereport 12 5000), report the consumed count of the lease
+func (s *Server) handleLeaseReport(r *Request) Reply {
+	leaseId, errReply := r.GetInt(0)
+	if errReply != nil {
+		return errReply
+	}
+
+	used, errReply := r.GetInt(1)
+	if errReply != nil {
+		return errReply
+	}
+	if len(r.Arguments) > 2 {
+		return ErrTooMuchArgs
+	}
+
+	if err := s.ReportLease(leaseId, used); err != nil {
+		return &ErrorReply{
+			message: err.Error(),
+		}
+	}
+
+	return &StatusReply{
+		code: "OK",
+	}
+}
+
 // redis command(set abc 12)
 func (s *Server) handleSet(r *Request) Reply {
 
@@ -79,7 +418,29 @@ func (s *Server) handleSet(r *Request) Reply {
 	}
 
 	// force reset id: set service_user 10 true
-	force, _ := r.GetBool(2)
+	// set service options: set service_user 10 BATCH 5000 MAX_BATCH 100000
+	var force bool
+	opts := make(map[string]string)
+	for i := 2; i < len(r.Arguments); i++ {
+		arg := string(r.Arguments[i])
+		if bl, err := strutil.Bool(arg); err == nil {
+			force = bl
+			continue
+		}
+
+		val, errReply := r.GetString(i + 1)
+		if errReply != nil {
+			return errReply
+		}
+
+		// check option name and value
+		if err = new(mysqlid.Options).Set(arg, val); err != nil {
+			return &ErrorReply{err.Error()}
+		}
+
+		opts[arg] = val
+		i++
+	}
 
 	// if r.HasArgument(0) == false {
 	// 	return ErrNotEnoughArgs
@@ -113,7 +474,7 @@ func (s *Server) handleSet(r *Request) Reply {
 	// }
 
 	// err = gen.Reset(idValue, false)
-	_, err = s.SetServiceId(serviceName, idValue, force)
+	_, err = s.SetService(serviceName, idValue, force, opts)
 	if err != nil {
 		return &ErrorReply{
 			message: err.Error(),
@@ -0,0 +1,256 @@
+package rdssrv
+
+import (
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// the server info on the HELLO reply
+var (
+	ServerName    = "genid"
+	ServerVersion = "1.0.1"
+)
+
+// the last client id, increased on each connection
+var lastClientId int64
+
+// Client the state of a client connection
+type Client struct {
+	Id   int64
+	Name string
+	Addr string
+}
+
+func newClient(addr string) *Client {
+	return &Client{
+		Id:   atomic.AddInt64(&lastClientId, 1),
+		Addr: addr,
+	}
+}
+
+// the command info for the COMMAND reply, the fields are same as redis:
+// name, arity(negative is the min count of arguments), flags, first key, last key, key step.
+type commandInfo struct {
+	name     string
+	arity    int
+	flags    []string
+	firstKey int
+	lastKey  int
+	step     int
+}
+
+var commandTable = []*commandInfo{
+	{"get", 2, []string{"write", "fast"}, 1, 1, 1},
+	{"getf", -2, []string{"write", "fast"}, 1, 1, 1},
+	{"getenc", 2, []string{"write", "fast"}, 1, 1, 1},
+	{"decode", 3, []string{"readonly", "fast"}, 1, 1, 1},
+	{"set", -3, []string{"write"}, 1, 1, 1},
+	{"incr", 2, []string{"write", "fast"}, 1, 1, 1},
+	{"incrby", 3, []string{"write", "fast"}, 1, 1, 1},
+	{"mget", -2, []string{"write", "fast"}, 1, -1, 1},
+	{"mset", -3, []string{"write"}, 1, -1, 2},
+	{"mgetids", 3, []string{"write"}, 1, 1, 1},
+	{"lease", -3, []string{"write"}, 1, 1, 1},
+	{"leasereport", 3, []string{"write"}, 0, 0, 0},
+	{"exists", 2, []string{"readonly", "fast"}, 1, 1, 1},
+	{"del", 2, []string{"write"}, 1, 1, 1},
+	{"select", 2, []string{"loading", "stale", "fast"}, 0, 0, 0},
+	{"ping", -1, []string{"stale", "fast"}, 0, 0, 0},
+	{"echo", 2, []string{"stale", "fast"}, 0, 0, 0},
+	{"quit", -1, []string{"loading", "stale", "fast"}, 0, 0, 0},
+	{"command", -1, []string{"loading", "stale"}, 0, 0, 0},
+	{"hello", -1, []string{"loading", "stale", "fast"}, 0, 0, 0},
+	{"client", -2, []string{"loading", "stale"}, 0, 0, 0},
+}
+
+func (c *commandInfo) reply() Reply {
+	flags := make([]Reply, len(c.flags))
+	for i, flag := range c.flags {
+		flags[i] = &StatusReply{code: flag}
+	}
+
+	return &ArrayReply{values: []Reply{
+		&BulkReply{value: []byte(c.name)},
+		&IntReply{number: int64(c.arity)},
+		&ArrayReply{values: flags},
+		&IntReply{number: int64(c.firstKey)},
+		&IntReply{number: int64(c.lastKey)},
+		&IntReply{number: int64(c.step)},
+	}}
+}
+
+func findCommand(name string) *commandInfo {
+	name = strings.ToLower(name)
+	for _, c := range commandTable {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// redis command(ping [message]), returns PONG or the message
+func (s *Server) handlePing(r *Request) Reply {
+	if len(r.Arguments) > 1 {
+		return ErrTooMuchArgs
+	}
+	if r.HasArgument(0) {
+		return &BulkReply{value: r.Arguments[0]}
+	}
+
+	return &StatusReply{
+		code: "PONG",
+	}
+}
+
+// redis command(echo message)
+func (s *Server) handleEcho(r *Request) Reply {
+	if len(r.Arguments) != 1 {
+		return ErrWrongArgsNumber
+	}
+	return &BulkReply{value: r.Arguments[0]}
+}
+
+// redis command(quit), the connection is closed after replied
+func (s *Server) handleQuit(_ *Request) Reply {
+	return &StatusReply{
+		code: "OK",
+	}
+}
+
+// redis command(command [count|info name ...|docs ...]), returns the info of the supported commands
+func (s *Server) handleCommand(r *Request) Reply {
+	if !r.HasArgument(0) {
+		values := make([]Reply, len(commandTable))
+		for i, c := range commandTable {
+			values[i] = c.reply()
+		}
+		return &ArrayReply{values: values}
+	}
+
+	switch strings.ToUpper(string(r.Arguments[0])) {
+	case "COUNT":
+		return &IntReply{number: int64(len(commandTable))}
+	case "INFO":
+		values := make([]Reply, 0, len(r.Arguments)-1)
+		for _, name := range r.Arguments[1:] {
+			if c := findCommand(string(name)); c != nil {
+				values = append(values, c.reply())
+			} else {
+				values = append(values, &BulkReply{})
+			}
+		}
+		return &ArrayReply{values: values}
+	case "DOCS":
+		// no docs of the commands
+		return &ArrayReply{}
+	}
+
+	return &ErrorReply{message: "unknown subcommand of COMMAND. allow: COUNT,INFO,DOCS"}
+}
+
+// redis command(hello [protover [AUTH username password] [SETNAME clientname]]).
+// only the RESP2 is supported, the HELLO 3 is replied the NOPROTO error, the clients will fallback to RESP2.
+func (s *Server) handleHello(r *Request) Reply {
+	if r.HasArgument(0) {
+		ver, errReply := r.GetInt(0)
+		if errReply != nil {
+			return &ErrorReply{message: "Protocol version is not an integer or out of range"}
+		}
+		if ver != 2 {
+			return &CodeErrorReply{code: "NOPROTO", message: "unsupported protocol version"}
+		}
+	}
+
+	// the options, the AUTH is accepted without checking, no authentication on the server
+	var name string
+	for i := 1; i < len(r.Arguments); i++ {
+		switch strings.ToUpper(string(r.Arguments[i])) {
+		case "AUTH":
+			if i+2 >= len(r.Arguments) {
+				return ErrNotEnoughArgs
+			}
+			i += 2
+		case "SETNAME":
+			if i+1 >= len(r.Arguments) {
+				return ErrNotEnoughArgs
+			}
+			i++
+			name = string(r.Arguments[i])
+		default:
+			return &ErrorReply{message: "Syntax error in HELLO option " + string(r.Arguments[i])}
+		}
+	}
+
+	var clientId int64
+	if r.Client != nil {
+		if name != "" {
+			r.Client.Name = name
+		}
+		clientId = r.Client.Id
+	}
+
+	// the map is replied as the flat array on RESP2
+	return &ArrayReply{values: []Reply{
+		&BulkReply{value: []byte("server")},
+		&BulkReply{value: []byte(ServerName)},
+		&BulkReply{value: []byte("version")},
+		&BulkReply{value: []byte(ServerVersion)},
+		&BulkReply{value: []byte("proto")},
+		&IntReply{number: 2},
+		&BulkReply{value: []byte("id")},
+		&IntReply{number: clientId},
+		&BulkReply{value: []byte("mode")},
+		&BulkReply{value: []byte("standalone")},
+		&BulkReply{value: []byte("role")},
+		&BulkReply{value: []byte("master")},
+		&BulkReply{value: []byte("modules")},
+		&ArrayReply{},
+	}}
+}
+
+// redis command(client setname|getname|id|setinfo ...)
+func (s *Server) handleClient(r *Request) Reply {
+	sub, errReply := r.GetString(0)
+	if errReply != nil {
+		return errReply
+	}
+
+	client := r.Client
+	if client == nil {
+		client = &Client{}
+	}
+
+	switch strings.ToUpper(sub) {
+	case "SETNAME":
+		if len(r.Arguments) != 2 {
+			return ErrWrongArgsNumber
+		}
+
+		name := string(r.Arguments[1])
+		if strings.ContainsAny(name, " \n") {
+			return &ErrorReply{message: "Client names cannot contain spaces, newlines or special characters."}
+		}
+		client.Name = name
+		return &StatusReply{code: "OK"}
+	case "GETNAME":
+		if client.Name == "" {
+			return &BulkReply{}
+		}
+		return &BulkReply{value: []byte(client.Name)}
+	case "ID":
+		return &IntReply{number: client.Id}
+	case "SETINFO":
+		// the client library info, eg: lib-name, lib-ver. accept and ignore it.
+		if len(r.Arguments) != 3 {
+			return ErrWrongArgsNumber
+		}
+		return &StatusReply{code: "OK"}
+	case "INFO":
+		info := "id=" + strconv.FormatInt(client.Id, 10) + " addr=" + client.Addr + " name=" + client.Name
+		return &BulkReply{value: []byte(info)}
+	}
+
+	return &ErrorReply{message: "unknown subcommand of CLIENT. allow: SETNAME,GETNAME,ID,SETINFO,INFO"}
+}
@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"strconv"
 	"strings"
 
@@ -17,6 +16,8 @@ type Request struct {
 	Arguments     [][]byte
 	RemoteAddress string
 	Connection    io.ReadCloser
+	// Client the state of the client connection
+	Client *Client
 }
 
 // HasArgument check by index
@@ -65,63 +66,132 @@ func (r *Request) GetInt(index int) (int64, *ErrorReply) {
 	return n, nil
 }
 
-// NewRequest from connection
+// NewRequest from connection.
+// NOTICE: the bytes buffered after the request are discarded, use ReadRequest with a reader per connection
+// for the pipelined requests.
 func NewRequest(conn io.ReadCloser) (*Request, error) {
-	reader := bufio.NewReader(conn)
-
-	// *<number of arguments>CRLF
-	line, err := reader.ReadString('\n')
+	request, err := ReadRequest(bufio.NewReader(conn))
 	if err != nil {
 		return nil, err
 	}
 
-	var argCount int
-	if line[0] == '*' {
-		if _, err := fmt.Sscanf(line, "*%d\r\n", &argCount); err != nil {
-			return nil, Malformed("*<#Arguments>", line)
-		}
+	request.Connection = conn
+	return request, nil
+}
+
+// the limits of the request, the larger requests are replied with the protocol error
+var (
+	// MaxArgCount the max count of the arguments of a request, include the command
+	MaxArgCount = 1 << 16
+	// MaxBulkLength the max length of an argument
+	MaxBulkLength = 1 << 20
+	// MaxInlineLength the max length of the inline request, and the header lines of the multi bulk request
+	MaxInlineLength = 1 << 16
+)
+
+// ProtocolError the malformed request, is replied to the client as the error.
+// if it's fatal, the connection is closed after replied, because the following requests can not be parsed.
+type ProtocolError struct {
+	message string
+	Fatal   bool
+}
+
+func (e *ProtocolError) Error() string {
+	return "Protocol error: " + e.message
+}
 
-		// $<number of bytes of argument 1>CRLF
-		// <argument data>CRLF
-		command, err := readArgument(reader)
+// ReadRequest read a request from the buffered reader of the connection.
+// the reader should be reused on the connection, so the pipelined requests are not lost.
+//
+// both the multi bulk request(*<number of arguments>CRLF...) and the inline request(GET key CRLF) are supported.
+func ReadRequest(reader *bufio.Reader) (*Request, error) {
+	for {
+		line, err := readLine(reader)
 		if err != nil {
 			return nil, err
 		}
 
-		arguments := make([][]byte, argCount-1)
-		for i := 0; i < argCount-1; i++ {
-			if arguments[i], err = readArgument(reader); err != nil {
+		// the inline request. eg: telnet, nc
+		if len(line) == 0 || line[0] != '*' {
+			args, err := splitArgs(line)
+			if err != nil {
 				return nil, err
 			}
+			// skip the empty line
+			if len(args) == 0 {
+				continue
+			}
+			return newRequest(args), nil
 		}
 
-		return &Request{
-			Command:    strings.ToUpper(string(command)),
-			Arguments:  arguments,
-			Connection: conn,
-		}, nil
+		// *<number of arguments>CRLF
+		argCount, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, Malformed("*<#Arguments>", line)
+		}
+		// skip the empty request, like redis
+		if argCount <= 0 {
+			continue
+		}
+
+		return readMultiBulk(reader, argCount)
 	}
+}
 
-	return nil, fmt.Errorf("new request error")
+func newRequest(args [][]byte) *Request {
+	return &Request{
+		Command:   strings.ToUpper(string(args[0])),
+		Arguments: args[1:],
+	}
+}
+
+// read the arguments of the multi bulk request.
+// on the limits exceeded, returns the fatal error without reading the payload, the connection is closed after replied.
+func readMultiBulk(reader *bufio.Reader, argCount int) (*Request, error) {
+	if argCount > MaxArgCount {
+		return nil, &ProtocolError{message: fmt.Sprintf("the count of arguments exceeds %d", MaxArgCount), Fatal: true}
+	}
+
+	args := make([][]byte, 0, argCount)
+
+	// $<number of bytes of argument 1>CRLF
+	// <argument data>CRLF
+	for i := 0; i < argCount; i++ {
+		arg, err := readArgument(reader)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+
+	return newRequest(args), nil
 }
 
 func readArgument(reader *bufio.Reader) ([]byte, error) {
-	line, err := reader.ReadString('\n')
+	line, err := readLine(reader)
 	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 || line[0] != '$' {
 		return nil, Malformed("$<ArgumentLength>", line)
 	}
 
-	var argLength int
-	if _, err := fmt.Sscanf(line, "$%d\r\n", &argLength); err != nil {
+	argLength, err := strconv.Atoi(line[1:])
+	if err != nil || argLength < 0 {
 		return nil, Malformed("$<ArgumentLength>", line)
 	}
 
-	data, err := ioutil.ReadAll(io.LimitReader(reader, int64(argLength)))
-	if err != nil {
-		return nil, err
+	if argLength > MaxBulkLength {
+		return nil, &ProtocolError{message: fmt.Sprintf("the length of argument exceeds %d", MaxBulkLength), Fatal: true}
 	}
-	if len(data) != argLength {
-		return nil, MalformedLength(argLength, len(data))
+
+	data := make([]byte, argLength)
+	if n, err := io.ReadFull(reader, data); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, MalformedLength(argLength, n)
+		}
+		return nil, err
 	}
 
 	if b, err := reader.ReadByte(); err != nil || b != '\r' {
@@ -135,23 +205,153 @@ func readArgument(reader *bufio.Reader) ([]byte, error) {
 	return data, nil
 }
 
+// read a line without the line ending(CRLF or LF), the line length is limited by MaxInlineLength
+func readLine(reader *bufio.Reader) (string, error) {
+	var buf []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if len(buf)+len(chunk) > MaxInlineLength {
+			return "", &ProtocolError{message: "too big inline request", Fatal: true}
+		}
+
+		buf = append(buf, chunk...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		break
+	}
+
+	buf = buf[:len(buf)-1]
+	if n := len(buf); n > 0 && buf[n-1] == '\r' {
+		buf = buf[:n-1]
+	}
+	return string(buf), nil
+}
+
+// split the inline request to arguments, like the redis-cli:
+// the arguments are separated by spaces, and can be quoted by "..." with the escapes(\n, \xHH, ...) or '...'
+func splitArgs(line string) ([][]byte, error) {
+	var args [][]byte
+	for i := 0; ; {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			return args, nil
+		}
+
+		var arg []byte
+		inDouble, inSingle := false, false
+		for done := false; !done; i++ {
+			if i == len(line) {
+				if inDouble || inSingle {
+					return nil, &ProtocolError{message: "unbalanced quotes in request"}
+				}
+				break
+			}
+
+			c := line[i]
+			switch {
+			case inDouble:
+				if c == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHex(line[i+2]) && isHex(line[i+3]) {
+					arg = append(arg, hexValue(line[i+2])<<4|hexValue(line[i+3]))
+					i += 3
+				} else if c == '\\' && i+1 < len(line) {
+					i++
+					arg = append(arg, unescape(line[i]))
+				} else if c == '"' {
+					// the closing quote must be followed by a space or nothing
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, &ProtocolError{message: "unbalanced quotes in request"}
+					}
+					done = true
+				} else {
+					arg = append(arg, c)
+				}
+			case inSingle:
+				if c == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					arg = append(arg, '\'')
+				} else if c == '\'' {
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, &ProtocolError{message: "unbalanced quotes in request"}
+					}
+					done = true
+				} else {
+					arg = append(arg, c)
+				}
+			case isSpace(c):
+				done = true
+			case c == '"':
+				inDouble = true
+			case c == '\'':
+				inSingle = true
+			default:
+				arg = append(arg, c)
+			}
+		}
+
+		if arg == nil {
+			arg = []byte{}
+		}
+		args = append(args, arg)
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func hexValue(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	}
+	return c - '0'
+}
+
+func unescape(c byte) byte {
+	switch c {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'b':
+		return '\b'
+	case 'a':
+		return '\a'
+	}
+	return c
+}
+
 func Malformed(expected string, got string) error {
-	return fmt.Errorf("Mailformed request: %s does not match %s", got, expected)
+	return &ProtocolError{message: fmt.Sprintf("%s does not match %s", got, expected), Fatal: true}
 }
 
 func MalformedLength(expected int, got int) error {
-	return fmt.Errorf("Mailformed request: argument length %d does not match %d", got, expected)
+	return &ProtocolError{message: fmt.Sprintf("argument length %d does not match %d", got, expected), Fatal: true}
 }
 
 func MalformedMissingCRLF() error {
-	return fmt.Errorf("Mailformed request: line should end with CRLF")
+	return &ProtocolError{message: "line should end with CRLF", Fatal: true}
 }
 
 // Reply writer
 type Reply io.WriterTo
 
 var (
-	ErrMethodNotSupported   = &ErrorReply{"Method is not supported. allow: GET,SET,DEL,EXISTS,SELECT"}
+	ErrMethodNotSupported   = &ErrorReply{"Method is not supported. allow: GET,GETF,GETENC,DECODE,SET,INCR,INCRBY,MGET,MSET,MGETIDS,LEASE,LEASEREPORT,DEL,EXISTS,SELECT,PING,ECHO,QUIT,COMMAND,HELLO,CLIENT"}
 	ErrNotEnoughArgs        = &ErrorReply{"Not enough arguments for the command"}
 	ErrTooMuchArgs          = &ErrorReply{"Too many arguments for the command"}
 	ErrWrongArgsNumber      = &ErrorReply{"Wrong number of arguments"}
@@ -230,6 +430,43 @@ func (r *MultiBulkReply) WriteTo(w io.Writer) (int64, error) {
 	}
 }
 
+// ArrayReply the array of the replies, the elements can be any reply. eg: the nested arrays
+type ArrayReply struct {
+	values []Reply
+}
+
+func (r *ArrayReply) WriteTo(w io.Writer) (int64, error) {
+	total, err := w.Write([]byte("*" + strconv.Itoa(len(r.values)) + "\r\n"))
+	if err != nil {
+		return int64(total), err
+	}
+
+	n := int64(total)
+	for _, value := range r.values {
+		wrote, err := value.WriteTo(w)
+		n += wrote
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// CodeErrorReply the error reply with the error code. eg: "-NOPROTO unsupported protocol version"
+type CodeErrorReply struct {
+	code    string
+	message string
+}
+
+func (er *CodeErrorReply) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write([]byte("-" + er.code + " " + er.message + "\r\n"))
+	return int64(n), err
+}
+
+func (er *CodeErrorReply) Error() string {
+	return er.code + " " + er.message
+}
+
 func writeNullBytes(w io.Writer) (int64, error) {
 	n, err := w.Write([]byte("$-1\r\n"))
 	return int64(n), err
@@ -241,7 +478,8 @@ func writeBytes(value interface{}, w io.Writer) (int64, error) {
 	}
 	switch v := value.(type) {
 	case []byte:
-		if len(v) == 0 {
+		// the nil is the null bulk string, the empty bytes is the empty string "$0\r\n\r\n"
+		if v == nil {
 			return writeNullBytes(w)
 		}
 		buf := []byte("$" + strconv.Itoa(len(v)) + "\r\n")
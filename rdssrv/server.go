@@ -1,6 +1,8 @@
 package rdssrv
 
 import (
+	"bufio"
+	"io"
 	"net"
 	"runtime"
 
@@ -58,8 +60,13 @@ func (s *Server) Serve() error {
 }
 
 func (s *Server) onConn(conn net.Conn) {
+	clientAddr := conn.RemoteAddr().String()
+	// the reader and writer per connection, for the pipelined requests
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	client := newClient(clientAddr)
+
 	defer func() {
-		clientAddr := conn.RemoteAddr().String()
 		r := recover()
 		if err, ok := r.(error); ok {
 			const size = 4096
@@ -76,23 +83,53 @@ func (s *Server) onConn(conn net.Conn) {
 			}
 
 			// TODO ignore error
-			_, _ = reply.WriteTo(conn)
+			_, _ = reply.WriteTo(writer)
 		}
 
+		// write the replies of the handled requests
+		_ = writer.Flush()
 		// TODO ignore error
 		_ = conn.Close()
 	}()
 
 	for {
-		request, err := NewRequest(conn)
-		if err != nil {
-			slog.Error("new request error", err)
+		var reply Reply
+		request, err := ReadRequest(reader)
+		if err == nil {
+			request.RemoteAddress = clientAddr
+			request.Connection = conn
+			request.Client = client
+			reply = s.ServeRequest(request)
+		} else if pe, ok := err.(*ProtocolError); ok {
+			// reply the error instead of disconnect
+			slog.Warn("malformed request", "remoteAddr", clientAddr, "err", pe.Error())
+			reply = &ErrorReply{message: pe.Error()}
+		} else {
+			if err != io.EOF {
+				slog.Error("new request error", err)
+			}
+			return
+		}
+
+		if _, werr := reply.WriteTo(writer); werr != nil {
+			slog.Error("reply write error", werr)
 			return
 		}
 
-		reply := s.ServeRequest(request)
-		if _, err := reply.WriteTo(conn); err != nil {
-			slog.Error("reply write error", err)
+		// the following requests can not be parsed, the reply is flushed on close
+		if pe, ok := err.(*ProtocolError); ok && pe.Fatal {
+			return
+		}
+		if request != nil && request.Command == "QUIT" {
+			return
+		}
+
+		// the pipelined requests are buffered, answer them in a single write
+		if reader.Buffered() > 0 {
+			continue
+		}
+		if err := writer.Flush(); err != nil {
+			slog.Error("reply flush error", err)
 			return
 		}
 	}
@@ -103,14 +140,46 @@ func (s *Server) ServeRequest(request *Request) Reply {
 	switch request.Command {
 	case "GET":
 		return s.handleGet(request)
+	case "GETF":
+		return s.handleGetFormatted(request)
+	case "GETENC":
+		return s.handleGetEncoded(request)
+	case "DECODE":
+		return s.handleDecode(request)
 	case "SET":
 		return s.handleSet(request)
+	case "INCR":
+		return s.handleIncr(request)
+	case "INCRBY":
+		return s.handleIncrBy(request)
+	case "MGET":
+		return s.handleMGet(request)
+	case "MSET":
+		return s.handleMSet(request)
+	case "MGETIDS":
+		return s.handleMGetIds(request)
+	case "LEASE":
+		return s.handleLease(request)
+	case "LEASEREPORT":
+		return s.handleLeaseReport(request)
 	case "EXISTS":
 		return s.handleExists(request)
 	case "DEL":
 		return s.handleDel(request)
 	case "SELECT":
 		return s.handleSelect(request)
+	case "PING":
+		return s.handlePing(request)
+	case "ECHO":
+		return s.handleEcho(request)
+	case "QUIT":
+		return s.handleQuit(request)
+	case "COMMAND":
+		return s.handleCommand(request)
+	case "HELLO":
+		return s.handleHello(request)
+	case "CLIENT":
+		return s.handleClient(request)
 	default:
 		return ErrMethodNotSupported
 	}
@@ -126,5 +195,10 @@ func (s *Server) Close() {
 		}
 	}
 
+	// release the leased worker id
+	if err := s.Manager.Close(); err != nil {
+		slog.Error(err)
+	}
+
 	slog.Info("redis server closed!")
 }
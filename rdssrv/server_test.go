@@ -0,0 +1,289 @@
+package rdssrv
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/inherelab/genid/mysqlid"
+)
+
+// start the server on a pipe connection, returns the client side
+func newTestConn(t *testing.T) (net.Conn, *bufio.Reader) {
+	mgr := mysqlid.NewManager(mysqlid.NewMemoryStorage())
+	if err := mgr.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{Manager: mgr}
+	client, server := net.Pipe()
+	go s.onConn(server)
+
+	_ = client.SetDeadline(time.Now().Add(5 * time.Second))
+	return client, bufio.NewReader(client)
+}
+
+// read n reply lines
+func readLines(t *testing.T, r *bufio.Reader, n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read the reply %d error: %v", i, err)
+		}
+		lines[i] = strings.TrimSuffix(line, "\r\n")
+	}
+	return lines
+}
+
+func TestServer_pipeline(t *testing.T) {
+	client, r := newTestConn(t)
+	defer client.Close()
+
+	// the pipelined commands are sent in one write
+	cmds := "*3\r\n$3\r\nSET\r\n$3\r\nabc\r\n$3\r\n100\r\n" +
+		strings.Repeat("*2\r\n$3\r\nGET\r\n$3\r\nabc\r\n", 3) +
+		"*2\r\n$6\r\nEXISTS\r\n$3\r\nabc\r\n"
+
+	go func() {
+		_, _ = client.Write([]byte(cmds))
+	}()
+
+	want := []string{"+OK", "$3", "101", "$3", "102", "$3", "103", ":1"}
+	got := readLines(t, r, len(want))
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("the reply line %d should be %q, but got %q", i, want[i], got[i])
+		}
+	}
+}
+
+func TestServer_inline(t *testing.T) {
+	client, r := newTestConn(t)
+	defer client.Close()
+
+	go func() {
+		_, _ = client.Write([]byte("SET abc 100\r\n\r\nget abc\n  GET  \"abc\"  \r\nGET 'ab\r\nEXISTS abc\r\n"))
+	}()
+
+	want := []string{"+OK", "$3", "101", "$3", "102", "-ERROR Protocol error: unbalanced quotes in request", ":1"}
+	got := readLines(t, r, len(want))
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("the reply line %d should be %q, but got %q", i, want[i], got[i])
+		}
+	}
+}
+
+func TestServer_malformed(t *testing.T) {
+	maxArgs, maxBulk := MaxArgCount, MaxBulkLength
+	MaxArgCount, MaxBulkLength = 3, 8
+	defer func() { MaxArgCount, MaxBulkLength = maxArgs, maxBulk }()
+
+	tests := []struct {
+		request string
+		want    []string
+	}{
+		// the empty request is skipped
+		{"*-1\r\n*2\r\n$6\r\nEXISTS\r\n$3\r\nabc\r\n*2\r\nxx\r\n", []string{
+			":0",
+			"-ERROR Protocol error: xx does not match $<ArgumentLength>",
+		}},
+		// the payload over the limits is not read
+		{"*4\r\n$3\r\nGET\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n", []string{
+			"-ERROR Protocol error: the count of arguments exceeds 3",
+		}},
+		{"*2\r\n$3\r\nGET\r\n$10\r\n0123456789\r\n", []string{
+			"-ERROR Protocol error: the length of argument exceeds 8",
+		}},
+	}
+
+	for _, tt := range tests {
+		client, r := newTestConn(t)
+		go func(request string) {
+			_, _ = client.Write([]byte(request))
+		}(tt.request)
+
+		got := readLines(t, r, len(tt.want))
+		for i := range tt.want {
+			if got[i] != tt.want[i] {
+				t.Fatalf("the reply line %d should be %q, but got %q", i, tt.want[i], got[i])
+			}
+		}
+
+		// the connection is closed after the fatal error
+		if _, err := r.ReadString('\n'); err == nil {
+			t.Fatalf("the connection should be closed after %q", tt.want[len(tt.want)-1])
+		}
+		client.Close()
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	args, err := splitArgs(`SET "a b\x41\n" 'it\'s' ""`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"SET", "a bA\n", "it's", ""}
+	if len(args) != len(want) {
+		t.Fatalf("should split %d args, but got %q", len(want), args)
+	}
+	for i := range want {
+		if string(args[i]) != want[i] {
+			t.Fatalf("the arg %d should be %q, but got %q", i, want[i], args[i])
+		}
+	}
+
+	if _, err = splitArgs(`GET "abc"def`); err == nil {
+		t.Fatal("should returns error on the closing quote followed by chars")
+	}
+}
+
+func TestServer_handshake(t *testing.T) {
+	client, r := newTestConn(t)
+	defer client.Close()
+
+	go func() {
+		_, _ = client.Write([]byte("HELLO 3\r\nHELLO 2 SETNAME app\r\nCLIENT GETNAME\r\nPING\r\nPING hi\r\nECHO hi\r\n" +
+			"COMMAND COUNT\r\nCOMMAND INFO get unknown\r\nQUIT\r\nPING\r\n"))
+	}()
+
+	want := []string{
+		"-NOPROTO unsupported protocol version",
+		"*14", "$6", "server", "$5", "genid", "$7", "version", "$5", ServerVersion, "$5", "proto", ":2",
+		"$2", "id",
+	}
+	got := readLines(t, r, len(want))
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("the reply line %d should be %q, but got %q", i, want[i], got[i])
+		}
+	}
+
+	// skip the rest of HELLO reply: id, mode, role, modules
+	readLines(t, r, 1+4+4+3)
+
+	want = []string{
+		"$3", "app",
+		"+PONG",
+		"$2", "hi",
+		"$2", "hi",
+		":" + strconv.Itoa(len(commandTable)),
+		"*2", "*6", "$3", "get", ":2", "*2", "+write", "+fast", ":1", ":1", ":1", "$-1",
+		"+OK",
+	}
+	got = readLines(t, r, len(want))
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("the reply line %d should be %q, but got %q", i, want[i], got[i])
+		}
+	}
+
+	// the connection is closed after QUIT
+	if _, err := r.ReadString('\n'); err == nil {
+		t.Fatal("the connection should be closed after QUIT")
+	}
+}
+
+func TestServer_emptyBulk(t *testing.T) {
+	client, r := newTestConn(t)
+	defer client.Close()
+
+	// the empty string is replied as the empty bulk, not the null bulk
+	go func() {
+		_, _ = client.Write([]byte("*2\r\n$4\r\nECHO\r\n$0\r\n\r\n*2\r\n$4\r\nPING\r\n$0\r\n\r\nECHO \"\"\r\nCLIENT GETNAME\r\n"))
+	}()
+
+	want := []string{"$0", "", "$0", "", "$0", "", "$-1"}
+	got := readLines(t, r, len(want))
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("the reply line %d should be %q, but got %q", i, want[i], got[i])
+		}
+	}
+}
+
+func TestServer_msetPairs(t *testing.T) {
+	client, r := newTestConn(t)
+	defer client.Close()
+
+	go func() {
+		_, _ = client.Write([]byte("MSET\r\nMSET abc\r\nMSET abc 1 def\r\nEXISTS abc\r\n"))
+	}()
+
+	want := []string{
+		"-ERROR " + ErrExpectMorePair.message,
+		"-ERROR " + ErrExpectEvenPair.message,
+		"-ERROR " + ErrExpectEvenPair.message,
+		// the keys are not set on the error
+		":0",
+	}
+	got := readLines(t, r, len(want))
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("the reply line %d should be %q, but got %q", i, want[i], got[i])
+		}
+	}
+}
+
+func TestServer_incr(t *testing.T) {
+	client, r := newTestConn(t)
+	defer client.Close()
+
+	// the missing key is not created like GET. the INCRBY larger than the segment is allocated from the storage directly
+	go func() {
+		_, _ = client.Write([]byte("INCR abc\r\nINCRBY abc 5\r\nSET abc 0\r\nINCR abc\r\nINCRBY abc 5\r\nGET abc\r\nINCRBY abc 0\r\nINCRBY abc 100000\r\nINCR abc\r\n"))
+	}()
+
+	got := readLines(t, r, 10)
+	want := []string{"$-1", "$-1", "+OK", ":1", ":6", "$1", "7", "-ERROR Expected positive integer"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("the reply line %d should be %q, but got %q", i, want[i], got[i])
+		}
+	}
+
+	last, err := strconv.ParseInt(strings.TrimPrefix(got[8], ":"), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[9] != ":8" || last < 100007 {
+		t.Fatalf("the reserved ids should be after the current segment, got %v", got[8:])
+	}
+}
+
+func TestServer_multi(t *testing.T) {
+	client, r := newTestConn(t)
+	defer client.Close()
+
+	go func() {
+		_, _ = client.Write([]byte("MSET abc 100 def 200\r\nMGET abc missing def\r\nMSET abc x\r\n" +
+			"MSET ghi 300 abc 0\r\nMGET ghi abc\r\nMSET dup 10 dup 20\r\nGET dup\r\n" +
+			"*3\r\n$4\r\nMGET\r\n$3\r\nabc\r\n$0\r\n\r\nGET abc\r\n"))
+	}()
+
+	want := []string{
+		"+OK",
+		"*3", "$3", "101", "$-1", "$3", "201",
+		"-ERROR Expected integer",
+		// the existing key is not changed
+		"+OK",
+		"*2", "$3", "301", "$4", "2101",
+		// the duplicate key uses the last value
+		"+OK",
+		"$2", "21",
+		// the id of the former key is not used on the error
+		"-ERROR no key for set",
+		"$4", "2102",
+	}
+	got := readLines(t, r, len(want))
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("the reply line %d should be %q, but got %q", i, want[i], got[i])
+		}
+	}
+}
@@ -0,0 +1,218 @@
+// Package snowflake the time-based id generator, without the db dependency.
+//
+// the id layout(from high to low): 0 | timestamp(ms since epoch) | worker id | sequence
+package snowflake
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultEpoch 2020-01-01 00:00:00 UTC, in milliseconds
+	DefaultEpoch = 1577836800000
+	// DefaultWorkerBits the default bits of worker id
+	DefaultWorkerBits = 10
+	// DefaultSeqBits the default bits of sequence in one millisecond
+	DefaultSeqBits = 12
+	// DefaultMaxBackward the default max clock backward milliseconds to wait
+	DefaultMaxBackward = 10
+	// DefaultLeaseTTL the default ttl seconds of the worker id lease
+	DefaultLeaseTTL = 30
+
+	// MaxNodeBits the max bits of worker id + sequence. keep 41 bits for timestamp, about 69 years.
+	MaxNodeBits = 22
+)
+
+var (
+	// ErrClockBackward the clock moved backwards more than Config.MaxBackward
+	ErrClockBackward = errors.New("snowflake: clock moved backwards")
+	// ErrTimeOverflow the timestamp is overflow the timestamp bits
+	ErrTimeOverflow = errors.New("snowflake: the timestamp is overflow, please check the epoch")
+)
+
+// Config for the snowflake generator
+type Config struct {
+	// Epoch the start time of the timestamp, in milliseconds. default is DefaultEpoch
+	Epoch int64 `toml:"epoch" mapstructure:"epoch"`
+	// WorkerId the unique id of the node, must be less than 1<<WorkerBits
+	WorkerId   int64 `toml:"worker_id" mapstructure:"worker_id"`
+	WorkerBits uint  `toml:"worker_bits" mapstructure:"worker_bits"`
+	SeqBits    uint  `toml:"seq_bits" mapstructure:"seq_bits"`
+	// MaxBackward wait the clock catch up if it moved backwards less than MaxBackward milliseconds,
+	// otherwise returns ErrClockBackward.
+	MaxBackward int64 `toml:"max_backward" mapstructure:"max_backward"`
+
+	// WorkerLease lease the unique worker id from the storage on startup, instead of the WorkerId setting.
+	// the lease is renewed on background, and expired after LeaseTTL seconds without renew.
+	WorkerLease bool  `toml:"worker_lease" mapstructure:"worker_lease"`
+	LeaseTTL    int64 `toml:"lease_ttl" mapstructure:"lease_ttl"`
+}
+
+// NewConfig create config with default settings
+func NewConfig() *Config {
+	return &Config{
+		Epoch:       DefaultEpoch,
+		WorkerBits:  DefaultWorkerBits,
+		SeqBits:     DefaultSeqBits,
+		MaxBackward: DefaultMaxBackward,
+		LeaseTTL:    DefaultLeaseTTL,
+	}
+}
+
+// MaxWorkerId get the max worker id
+func (c *Config) MaxWorkerId() int64 {
+	return 1<<c.WorkerBits - 1
+}
+
+// Validate config settings
+func (c *Config) Validate() error {
+	if c.SeqBits == 0 || c.WorkerBits+c.SeqBits > MaxNodeBits {
+		return fmt.Errorf("snowflake: worker_bits + seq_bits must be in 1 ~ %d", MaxNodeBits)
+	}
+	if c.WorkerId < 0 || c.WorkerId > c.MaxWorkerId() {
+		return fmt.Errorf("snowflake: the worker id must be in 0 ~ %d", c.MaxWorkerId())
+	}
+	if c.Epoch < 0 || c.Epoch > nowMillis() {
+		return fmt.Errorf("snowflake: invalid epoch %d", c.Epoch)
+	}
+	return nil
+}
+
+// Generator the snowflake id generator. implements the genid.GeneratorFace
+type Generator struct {
+	lock sync.Mutex
+	cfg  Config
+
+	seqMask   int64
+	maxTime   int64
+	timeShift uint
+
+	// the last timestamp, milliseconds since epoch
+	last    int64
+	seq     int64
+	current int64
+
+	// get the current milliseconds since unix epoch
+	now func() int64
+}
+
+// New create snowflake generator
+func New(c *Config) (*Generator, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	timeShift := c.WorkerBits + c.SeqBits
+	return &Generator{
+		cfg:       *c,
+		seqMask:   1<<c.SeqBits - 1,
+		maxTime:   1<<(63-timeShift) - 1,
+		timeShift: timeShift,
+		now:       nowMillis,
+	}, nil
+}
+
+// WorkerId get the worker id
+func (g *Generator) WorkerId() int64 {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return g.cfg.WorkerId
+}
+
+// SetWorkerId replace the worker id. eg: the leased worker id is changed
+func (g *Generator) SetWorkerId(workerId int64) error {
+	if workerId < 0 || workerId > g.cfg.MaxWorkerId() {
+		return fmt.Errorf("snowflake: the worker id must be in 0 ~ %d", g.cfg.MaxWorkerId())
+	}
+
+	g.lock.Lock()
+	g.cfg.WorkerId = workerId
+	g.lock.Unlock()
+	return nil
+}
+
+// Current get the last generated id
+func (g *Generator) Current() int64 {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return g.current
+}
+
+// Next generate next id
+func (g *Generator) Next() (int64, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return g.next()
+}
+
+// NextN generate n ids in one locked operation
+func (g *Generator) NextN(n int) ([]int64, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	ids := make([]int64, n)
+	for i := range ids {
+		id, err := g.next()
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+func (g *Generator) next() (int64, error) {
+	ts := g.now() - g.cfg.Epoch
+	if ts < g.last {
+		backward := g.last - ts
+		if backward > g.cfg.MaxBackward {
+			return 0, fmt.Errorf("%s %d ms", ErrClockBackward.Error(), backward)
+		}
+
+		// wait the clock catch up
+		time.Sleep(time.Duration(backward) * time.Millisecond)
+		if ts = g.now() - g.cfg.Epoch; ts < g.last {
+			return 0, ErrClockBackward
+		}
+	}
+
+	if ts == g.last {
+		g.seq = (g.seq + 1) & g.seqMask
+		// the sequence is exhausted in the millisecond, wait next millisecond
+		if g.seq == 0 {
+			for ts <= g.last {
+				time.Sleep(100 * time.Microsecond)
+				ts = g.now() - g.cfg.Epoch
+			}
+		}
+	} else {
+		g.seq = 0
+	}
+
+	if ts > g.maxTime {
+		return 0, ErrTimeOverflow
+	}
+
+	g.last = ts
+	g.current = ts<<g.timeShift | g.cfg.WorkerId<<g.cfg.SeqBits | g.seq
+	return g.current, nil
+}
+
+// Decode the id to the generated time, worker id and sequence
+func (g *Generator) Decode(id int64) (t time.Time, workerId, seq int64) {
+	ms := id>>g.timeShift + g.cfg.Epoch
+	workerId = id >> g.cfg.SeqBits & g.cfg.MaxWorkerId()
+	seq = id & g.seqMask
+
+	return time.Unix(0, ms*int64(time.Millisecond)), workerId, seq
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
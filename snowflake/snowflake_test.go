@@ -0,0 +1,100 @@
+package snowflake_test
+
+import (
+	"testing"
+
+	"github.com/inherelab/genid"
+	"github.com/inherelab/genid/idtest"
+	"github.com/inherelab/genid/snowflake"
+)
+
+func TestGenerator(t *testing.T) {
+	idtest.RunGenerator(t, func(t *testing.T, name string) genid.GeneratorFace {
+		c := snowflake.NewConfig()
+		c.WorkerId = 3
+
+		gen, err := snowflake.New(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return gen
+	})
+}
+
+func TestGenerator_Decode(t *testing.T) {
+	c := snowflake.NewConfig()
+	c.WorkerId = 5
+	c.WorkerBits = 4
+	c.SeqBits = 2
+
+	gen, err := snowflake.New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := c.Epoch + 1000
+	gen.SetClock(func() int64 { return now })
+
+	for i := int64(0); i < 4; i++ {
+		id, err := gen.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ts, workerId, seq := gen.Decode(id)
+		if ts.UnixNano() != now*1e6 || workerId != 5 || seq != i {
+			t.Fatalf("decode id %d got: %v %d %d", id, ts, workerId, seq)
+		}
+	}
+}
+
+func TestGenerator_clockBackward(t *testing.T) {
+	c := snowflake.NewConfig()
+	c.MaxBackward = 5
+
+	gen, err := snowflake.New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := c.Epoch + 1000
+	gen.SetClock(func() int64 { return now })
+	last, err := gen.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// more than MaxBackward
+	now -= 10
+	if _, err = gen.Next(); err == nil {
+		t.Fatal("should returns error on the clock moved backwards")
+	}
+
+	// less than MaxBackward, wait the clock catch up
+	now += 8
+	gen.SetClock(func() int64 {
+		now++
+		return now
+	})
+	id, err := gen.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id <= last {
+		t.Fatalf("the id %d is not greater than the last id %d", id, last)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	c := snowflake.NewConfig()
+	c.WorkerId = 1024
+	if _, err := snowflake.New(c); err == nil {
+		t.Fatal("should returns error on the worker id is overflow")
+	}
+
+	c = snowflake.NewConfig()
+	c.WorkerBits = 16
+	if _, err := snowflake.New(c); err == nil {
+		t.Fatal("should returns error on the bits is too large")
+	}
+}
@@ -0,0 +1,341 @@
+package sqliteid
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/gookit/slog"
+	"github.com/inherelab/genid/mysqlid"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	// DefaultTableName the default id table name
+	DefaultTableName = "_idgen_keys"
+
+	CreateTableSQLFormat = `CREATE TABLE IF NOT EXISTS %s (
+    k VARCHAR(128) NOT NULL PRIMARY KEY,
+    id INTEGER NOT NULL DEFAULT 0,
+    options TEXT NOT NULL DEFAULT ''
+)`
+
+	SelectKeysSQLFormat    = "SELECT `k` FROM `%s`"
+	SelectIdSQLFormat      = "SELECT `id` FROM `%s` WHERE `k` = ?"
+	UpdateIdSQLFormat      = "UPDATE `%s` SET `id` = `id` + ? WHERE `k` = ?"
+	ResetIdSQLFormat       = "UPDATE `%s` SET `id` = ? WHERE `k` = ?"
+	WrapIdSQLFormat        = "UPDATE `%s` SET `id` = ? WHERE `k` = ? AND `id` >= ?"
+	InsertRowSQLFormat     = "INSERT INTO `%s` (`k`, `id`) VALUES (?, ?)"
+	DeleteRowSQLFormat     = "DELETE FROM `%s` WHERE `k` = ?"
+	SelectOptionsSQLFormat = "SELECT `options` FROM `%s` WHERE `k` = ?"
+	UpdateOptionsSQLFormat = "UPDATE `%s` SET `options` = ? WHERE `k` = ?"
+
+	// create the range lease table, named table + mysqlid.LeaseTableSuffix. same as mysqlid.CreateLeaseTableSQLFormat
+	CreateLeaseTableSQLFormat = `CREATE TABLE IF NOT EXISTS %s (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    k VARCHAR(128) NOT NULL,
+    client VARCHAR(255) NOT NULL DEFAULT '',
+    start_id INTEGER NOT NULL,
+    end_id INTEGER NOT NULL,
+    step INTEGER NOT NULL DEFAULT 1,
+    used INTEGER NOT NULL DEFAULT 0,
+    created_at INTEGER NOT NULL DEFAULT 0,
+    reported_at INTEGER NOT NULL DEFAULT 0
+)`
+	CreateLeaseIndexSQLFormat = "CREATE INDEX IF NOT EXISTS `%s_k` ON `%s` (`k`)"
+)
+
+// Config for the SQLite storage
+type Config struct {
+	// File the SQLite database file path
+	File string `mapstructure:"file" yaml:"file"`
+	// TableName the id table name. default is DefaultTableName
+	TableName string `mapstructure:"table_name" yaml:"table_name"`
+}
+
+// OpenDB open the SQLite database file
+func OpenDB(file string) (*sql.DB, error) {
+	// the write transaction must take the lock on begin, same as the "SELECT ... FOR UPDATE" on MySQL.
+	dsn := fmt.Sprintf("file:%s?_busy_timeout=5000&_txlock=immediate&_journal_mode=WAL", file)
+
+	slog.Infof("init SQLite DB connection, file:%s", file)
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only allows one writer at a time
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// Storage the SQLite storage, all services are stored as rows in one table.
+// it has the same range allocation semantics as the MySQL tables.
+type Storage struct {
+	db    *sql.DB
+	table string
+}
+
+var (
+	_ mysqlid.Storage     = (*Storage)(nil)
+	_ mysqlid.RangeLeaser = (*Storage)(nil)
+)
+
+// NewStorage instance
+func NewStorage(db *sql.DB, table string) *Storage {
+	if table == "" {
+		table = DefaultTableName
+	}
+
+	return &Storage{db: db, table: table}
+}
+
+// NewStorageByConfig open the database file and create storage
+func NewStorageByConfig(c *Config) (*Storage, error) {
+	if c.File == "" {
+		return nil, fmt.Errorf("sqlite: the database file is required")
+	}
+
+	db, err := OpenDB(c.File)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewStorage(db, c.TableName), nil
+}
+
+// DB get the sql db
+func (s *Storage) DB() *sql.DB {
+	return s.db
+}
+
+func (s *Storage) leaseTable() string {
+	return s.table + mysqlid.LeaseTableSuffix
+}
+
+// Init create the id table and the lease table
+func (s *Storage) Init() error {
+	leaseTable := s.leaseTable()
+	sqlList := []string{
+		fmt.Sprintf(CreateTableSQLFormat, s.table),
+		fmt.Sprintf(CreateLeaseTableSQLFormat, leaseTable),
+		fmt.Sprintf(CreateLeaseIndexSQLFormat, leaseTable, leaseTable),
+	}
+
+	for _, createSQL := range sqlList {
+		slog.Infof("SQL=%s", createSQL)
+		if _, err := s.db.Exec(createSQL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Keys list all service keys
+func (s *Storage) Keys() ([]string, error) {
+	selectKeysSQL := fmt.Sprintf(SelectKeysSQLFormat, s.table)
+
+	slog.Infof("SQL=%s", selectKeysSQL)
+	rows, err := s.db.Query(selectKeysSQL)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		key := ""
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// Exists check the service row exists
+func (s *Storage) Exists(key string) (bool, error) {
+	_, exists, err := s.lastId(s.db, key)
+	return exists, err
+}
+
+// Current get last id of the key
+func (s *Storage) Current(key string) (int64, error) {
+	id, _, err := s.lastId(s.db, key)
+	return id, err
+}
+
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func (s *Storage) lastId(q queryer, key string) (id int64, exists bool, err error) {
+	selectIdSQL := fmt.Sprintf(SelectIdSQLFormat, s.table)
+
+	slog.Debugf("SQL=%s key=%s", selectIdSQL, key)
+	err = q.QueryRow(selectIdSQL, key).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return id, true, nil
+}
+
+// Alloc allocate an id range of size for the key. returns the range start
+func (s *Storage) Alloc(key string, size int64) (int64, error) {
+	// begin immediate, see OpenDB
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	id, exists, err := s.lastId(tx, key)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if !exists {
+		tx.Rollback()
+		return 0, fmt.Errorf("%s: have no id name", key)
+	}
+
+	updateIdSQL := fmt.Sprintf(UpdateIdSQLFormat, s.table)
+	slog.Infof("dbId=%d SQL=%s key=%s size=%d", id, updateIdSQL, key, size)
+	if _, err = tx.Exec(updateIdSQL, size, key); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Wrap reset the id to id by one conditional update, only if the current id is not less than the threshold.
+func (s *Storage) Wrap(key string, threshold, id int64) (int64, bool, error) {
+	wrapIdSQL := fmt.Sprintf(WrapIdSQLFormat, s.table)
+
+	slog.Infof("SQL=%s key=%s threshold=%d id=%d", wrapIdSQL, key, threshold, id)
+	ret, err := s.db.Exec(wrapIdSQL, id, key, threshold)
+	if err != nil {
+		return 0, false, err
+	}
+
+	n, err := ret.RowsAffected()
+	if err != nil || n > 0 {
+		return id, n > 0, err
+	}
+
+	cur, err := s.Current(key)
+	return cur, false, err
+}
+
+// Reset the service row. if the row exists and force=false, will not change the id.
+func (s *Storage) Reset(key string, idOffset int64, force bool) (int64, error) {
+	id, exists, err := s.lastId(s.db, key)
+	if err != nil {
+		return 0, err
+	}
+
+	// NOTICE: dont update db id value to `idOffset`.
+	if exists && !force {
+		return id, nil
+	}
+
+	if exists {
+		resetIdSQL := fmt.Sprintf(ResetIdSQLFormat, s.table)
+		slog.Infof("SQL=%s key=%s id=%d", resetIdSQL, key, idOffset)
+		_, err = s.db.Exec(resetIdSQL, idOffset, key)
+	} else {
+		insertRowSQL := fmt.Sprintf(InsertRowSQLFormat, s.table)
+		slog.Infof("SQL=%s key=%s id=%d", insertRowSQL, key, idOffset)
+		_, err = s.db.Exec(insertRowSQL, key, idOffset)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+	return idOffset, nil
+}
+
+// Delete the service row
+func (s *Storage) Delete(key string) error {
+	deleteRowSQL := fmt.Sprintf(DeleteRowSQLFormat, s.table)
+
+	slog.Infof("SQL=%s key=%s", deleteRowSQL, key)
+	_, err := s.db.Exec(deleteRowSQL, key)
+	return err
+}
+
+// Options get service options of the key
+func (s *Storage) Options(key string) (*mysqlid.Options, error) {
+	var str string
+	selectOptionsSQL := fmt.Sprintf(SelectOptionsSQLFormat, s.table)
+
+	slog.Debugf("SQL=%s key=%s", selectOptionsSQL, key)
+	err := s.db.QueryRow(selectOptionsSQL, key).Scan(&str)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	return mysqlid.ParseOptions(str)
+}
+
+// SaveOptions save service options of the key
+func (s *Storage) SaveOptions(key string, opts *mysqlid.Options) error {
+	updateOptionsSQL := fmt.Sprintf(UpdateOptionsSQLFormat, s.table)
+
+	slog.Infof("SQL=%s key=%s options=%s", updateOptionsSQL, key, opts.String())
+	_, err := s.db.Exec(updateOptionsSQL, opts.String(), key)
+	return err
+}
+
+// SaveLease record the leased range
+func (s *Storage) SaveLease(lease *mysqlid.RangeLease) error {
+	insertSQL := fmt.Sprintf(mysqlid.InsertLeaseSQLFormat, s.leaseTable())
+
+	slog.Infof("SQL=%s key=%s client=%s range=[%d, %d]", insertSQL, lease.Key, lease.Client, lease.Start, lease.End)
+	ret, err := s.db.Exec(insertSQL, lease.Key, lease.Client, lease.Start, lease.End, lease.Step, lease.CreatedAt.Unix())
+	if err != nil {
+		return err
+	}
+
+	lease.Id, err = ret.LastInsertId()
+	return err
+}
+
+// ReportLease update the consumed count of the lease
+func (s *Storage) ReportLease(id, used int64) error {
+	reportSQL := fmt.Sprintf(mysqlid.ReportLeaseSQLFormat, s.leaseTable())
+
+	slog.Infof("SQL=%s id=%d used=%d", reportSQL, id, used)
+	ret, err := s.db.Exec(reportSQL, used, time.Now().Unix(), id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := ret.RowsAffected(); err == nil && n == 0 {
+		return mysqlid.ErrLeaseNotExists
+	}
+	return nil
+}
+
+// Leases list the range leases of the key
+func (s *Storage) Leases(key string) ([]*mysqlid.RangeLease, error) {
+	selectSQL := fmt.Sprintf(mysqlid.SelectLeaseSQLFormat, s.leaseTable())
+
+	slog.Infof("SQL=%s key=%s", selectSQL, key)
+	rows, err := s.db.Query(selectSQL, key)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	return mysqlid.ScanLeases(rows)
+}
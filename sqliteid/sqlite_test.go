@@ -0,0 +1,28 @@
+package sqliteid_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/inherelab/genid/idtest"
+	"github.com/inherelab/genid/mysqlid"
+	"github.com/inherelab/genid/sqliteid"
+)
+
+func TestStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "genid-sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	idtest.RunStorage(t, func(t *testing.T) mysqlid.Storage {
+		store, err := sqliteid.NewStorageByConfig(&sqliteid.Config{File: filepath.Join(dir, "genid.db")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
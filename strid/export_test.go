@@ -0,0 +1,6 @@
+package strid
+
+// SetClock set the clock of the generator, for testing.
+func (g *Generator) SetClock(now func() int64) {
+	g.now = now
+}
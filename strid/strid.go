@@ -0,0 +1,156 @@
+// Package strid the generators of the 128-bit sortable string ids: ULID and UUIDv7.
+//
+// the ids are monotonic increasing in the same millisecond: the random part of the last id is incremented by 1.
+package strid
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// crockford's base32 alphabet for ULID
+const encoding = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// Generator the sortable string id generator. implements the genid.StringGeneratorFace
+type Generator struct {
+	lock sync.Mutex
+	// the bits of the random part. the random part is hi(high bits) + lo(64 bits)
+	hiMax  uint64
+	format func(ms int64, hi, lo uint64) string
+
+	// the milliseconds and the random part of the last id
+	last    int64
+	hi, lo  uint64
+	current string
+
+	rand io.Reader
+	// get the current milliseconds since unix epoch
+	now func() int64
+}
+
+// NewULID create ULID generator. the layout: timestamp(48 bits) | random(80 bits)
+func NewULID() *Generator {
+	return newGenerator(16, formatULID)
+}
+
+// NewUUIDv7 create UUIDv7 generator. the layout: timestamp(48 bits) | ver(4) | rand_a(12) | var(2) | rand_b(62)
+func NewUUIDv7() *Generator {
+	return newGenerator(10, formatUUIDv7)
+}
+
+func newGenerator(hiBits uint, format func(ms int64, hi, lo uint64) string) *Generator {
+	return &Generator{
+		hiMax:  1<<hiBits - 1,
+		format: format,
+		rand:   rand.Reader,
+		now:    nowMillis,
+	}
+}
+
+// CurrentString get the last generated id
+func (g *Generator) CurrentString() string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return g.current
+}
+
+// NextString generate next id
+func (g *Generator) NextString() (string, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	return g.next()
+}
+
+// NextStrings generate n ids in one locked operation
+func (g *Generator) NextStrings(n int) ([]string, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	ids := make([]string, n)
+	for i := range ids {
+		id, err := g.next()
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+func (g *Generator) next() (string, error) {
+	ms := g.now()
+	// in the same millisecond, or the clock moved backwards: increment the random part of the last id.
+	if ms <= g.last && g.increment() {
+		ms = g.last
+	} else {
+		if ms <= g.last {
+			// the random part is overflow, move to next millisecond
+			ms = g.last + 1
+		}
+
+		if err := g.random(); err != nil {
+			return "", err
+		}
+	}
+
+	g.last = ms
+	g.current = g.format(ms, g.hi, g.lo)
+	return g.current, nil
+}
+
+// increment the random part by 1. returns false on overflow
+func (g *Generator) increment() bool {
+	g.lo++
+	if g.lo == 0 {
+		g.hi++
+	}
+	return g.hi <= g.hiMax
+}
+
+func (g *Generator) random() error {
+	var buf [16]byte
+	if _, err := io.ReadFull(g.rand, buf[:]); err != nil {
+		return fmt.Errorf("strid: read random error: %s", err.Error())
+	}
+
+	g.hi = binary.BigEndian.Uint64(buf[:8]) & g.hiMax
+	g.lo = binary.BigEndian.Uint64(buf[8:])
+	return nil
+}
+
+// the 128 bits: ms(48) | hi(16) | lo(64). encode per 5 bits to 26 chars.
+func formatULID(ms int64, hi, lo uint64) string {
+	high := uint64(ms)<<16 | hi
+
+	var buf [26]byte
+	for i := 25; i >= 0; i-- {
+		buf[i] = encoding[lo&31]
+		lo = lo>>5 | high<<59
+		high >>= 5
+	}
+	return string(buf[:])
+}
+
+// the random part is 74 bits: rand_a = hi(10) + the top 2 bits of lo, rand_b = the lower 62 bits of lo
+func formatUUIDv7(ms int64, hi, lo uint64) string {
+	randA := hi<<2 | lo>>62
+	randB := lo & (1<<62 - 1)
+
+	return fmt.Sprintf("%08x-%04x-%04x-%04x-%012x",
+		uint64(ms)>>16,
+		uint64(ms)&0xffff,
+		0x7000|randA,
+		0x8000|randB>>48,
+		randB&(1<<48-1),
+	)
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
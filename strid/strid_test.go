@@ -0,0 +1,69 @@
+package strid_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/inherelab/genid/strid"
+)
+
+var (
+	ulidRegex = regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+	uuidRegex = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+)
+
+func TestGenerator(t *testing.T) {
+	tests := []struct {
+		name  string
+		gen   *strid.Generator
+		regex *regexp.Regexp
+	}{
+		{"ulid", strid.NewULID(), ulidRegex},
+		{"uuidv7", strid.NewUUIDv7(), uuidRegex},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the ids in same millisecond, and the clock moved backwards
+			clock := []int64{1600000000000, 1600000000000, 1600000000000, 1599999999000, 1600000000001}
+			i := 0
+			tt.gen.SetClock(func() int64 {
+				ms := clock[i%len(clock)]
+				i++
+				return ms
+			})
+
+			var last string
+			for n := 0; n < 20; n++ {
+				id, err := tt.gen.NextString()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !tt.regex.MatchString(id) {
+					t.Fatalf("invalid id format: %s", id)
+				}
+				if id <= last {
+					t.Fatalf("the id %s is not greater than the last id %s", id, last)
+				}
+				if cur := tt.gen.CurrentString(); cur != id {
+					t.Fatalf("the current id %s is not equals the last next id %s", cur, id)
+				}
+				last = id
+			}
+		})
+	}
+}
+
+func TestNewULID_timestamp(t *testing.T) {
+	gen := strid.NewULID()
+	gen.SetClock(func() int64 { return 1469918176385 })
+
+	id, err := gen.NextString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the example timestamp of the ULID spec
+	if id[:10] != "01ARYZ6S41" {
+		t.Fatalf("the timestamp part should be 01ARYZ6S41, but got %s", id[:10])
+	}
+}